@@ -21,7 +21,9 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -40,6 +42,10 @@ var (
 
 type tlsClientOptions struct {
 	insecureSkipVerify bool
+	caCertPath         string
+	certPath           string
+	keyPath            string
+	proxy              string
 }
 
 func main() {
@@ -47,24 +53,38 @@ func main() {
 	app.Name = "snaptel"
 	app.Version = gitversion
 	app.Usage = "The open telemetry framework"
-	app.Flags = []cli.Flag{snaptel.FlURL, snaptel.FlSecure, snaptel.FlAPIVer, snaptel.FlPassword, snaptel.FlConfig, snaptel.FlTimeout}
+	app.Flags = []cli.Flag{snaptel.FlURL, snaptel.FlSecure, snaptel.FlAPIVer, snaptel.FlPassword, snaptel.FlConfig, snaptel.FlTimeout, snaptel.FlOutput, snaptel.FlDebugHTTP, snaptel.FlTiming, snaptel.FlRetries, snaptel.FlRetryBackoff, snaptel.FlRetryAll, snaptel.FlHeader, snaptel.FlToken, snaptel.FlTokenFile, snaptel.FlProxy}
 	app.Commands = snaptel.Commands
+	aliases, err := snaptel.AliasCommands(snaptel.ConfigPath(app.Flags, os.Args[1:]), app.Commands)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	app.Commands = append(app.Commands, aliases...)
+	// the PATH is only scanned for extensions to list them, they are else
+	// looked up when no command matches
+	if snaptel.ListsExtensions(app.Flags, os.Args[1:]) {
+		app.Commands = append(app.Commands, snaptel.ExtensionCommands(app.Commands)...)
+	}
+	app.Action = snaptel.RunExtension
 	sort.Sort(ByCommand(app.Commands))
 	app.Before = beforeAction
 
 	app.Setup()
-	err := app.Run(os.Args)
+	err = app.Run(os.Args)
 	if err != nil {
-		fmt.Println(err)
-		if ue, ok := err.(snaptel.UsageError); ok {
-			ue.Help()
-		}
-		os.Exit(1)
+		snaptel.PrintError(err)
+		os.Exit(snaptel.ExitStatus(err))
 	}
 }
 
 // Run before every command
 func beforeAction(ctx *cli.Context) error {
+	// aliases and flag defaults of the config file come first, as they may
+	// set global flags
+	if err := snaptel.ApplyConfig(ctx); err != nil {
+		return err
+	}
 	snaptel.FlURL.Value = ctx.String("url")
 	snaptel.FlAPIVer.Value = ctx.String("api-version")
 
@@ -73,28 +93,79 @@ func beforeAction(ctx *cli.Context) error {
 		glog.Fatal(err)
 	}
 
-	tlsOpts := tlsClientOptions{insecureSkipVerify: ctx.Bool("insecure")}
+	tlsOpts := tlsClientOptions{insecureSkipVerify: ctx.Bool("insecure"), proxy: ctx.String("proxy")}
+	var tlsErr error
+	tlsOpts.caCertPath, tlsOpts.certPath, tlsOpts.keyPath, tlsErr = snaptel.TLSFiles(ctx)
 	tlsClient := tlsClient(tlsOpts)
+	if tlsErr != nil {
+		tlsClient.Transport = brokenTransport{tlsErr}
+	}
+	transport := snaptel.NewDebugTransport(tlsClient.Transport, ctx.Bool("debug-http"), ctx.Bool("timing"))
+	if _, broken := tlsClient.Transport.(brokenTransport); !broken {
+		// every attempt is logged
+		transport = snaptel.NewRetryTransport(transport, ctx.Int("retries"), ctx.Duration("retry-backoff"), ctx.Bool("retry-all"))
+	}
+	tlsClient.Transport = transport
 	rt := openapiclient.NewWithClient(u.Host, snaptel.FlAPIVer.Value, []string{u.Scheme}, tlsClient)
 	c := client.New(rt, nil)
 	snaptel.SetClient(c)
+	snaptel.SetHTTPClient(tlsClient)
 	snaptel.SetScheme(u.Scheme)
-	snaptel.SetAuthInfo(snaptel.BasicAuth(ctx))
+	snaptel.SetAuthInfo(snaptel.AuthInfo(ctx))
 
 	return nil
 }
 
 // tlsClient creates a http.Client
 func tlsClient(opts tlsClientOptions) *http.Client {
-	transport := tlsTransport(opts)
+	transport, err := tlsTransport(opts)
+	if err != nil {
+		transport = brokenTransport{err}
+	}
 	return &http.Client{Transport: transport}
 }
 
-func tlsTransport(opts tlsClientOptions) http.RoundTripper {
+// brokenTransport fails every request with the error of the setup of the
+// transport, so that the commands sending none, like config set, still run.
+type brokenTransport struct {
+	err error
+}
+
+func (t brokenTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+func tlsTransport(opts tlsClientOptions) (http.RoundTripper, error) {
 	cfg := &tls.Config{}
 	cfg.InsecureSkipVerify = opts.insecureSkipVerify
+	if opts.caCertPath != "" {
+		pem, err := ioutil.ReadFile(opts.caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the CA certificate: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Error: no certificate found in %s", opts.caCertPath)
+		}
+	}
+	if opts.certPath != "" {
+		cert, err := tls.LoadX509KeyPair(opts.certPath, opts.keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
 	cfg.BuildNameToCertificate()
-	return &http.Transport{TLSClientConfig: cfg}
+	// the proxy of the environment, unless one is given
+	proxy := http.ProxyFromEnvironment
+	if opts.proxy != "" {
+		u, err := url.Parse(opts.proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("Error: bad proxy URL '%s'", opts.proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	return &http.Transport{TLSClientConfig: cfg, Proxy: proxy}, nil
 }
 
 // ByCommand contains array of CLI commands.
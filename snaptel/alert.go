@@ -0,0 +1,299 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+)
+
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// alertCondRe matches the value condition of an alert rule, e.g. value>4
+var alertCondRe = regexp.MustCompile(`^value(>=|<=|==|!=|>|<)(.+)$`)
+
+// alertRule is a threshold rule evaluated against the metrics of a task watch stream.
+//
+// Rules are written as space separated terms, e.g.
+//
+//	ns=/intel/procfs/load/* value>4 for 30s
+//
+// where ns is an optional namespace pattern (path.Match syntax), value is
+// compared with one of >, >=, <, <=, == or != and the optional "for" duration
+// is the time the condition has to hold (or clear) before the rule fires (or resolves).
+type alertRule struct {
+	expr      string
+	ns        string
+	op        string
+	threshold float64
+	hold      time.Duration
+}
+
+func parseAlertRule(expr string) (*alertRule, error) {
+	r := &alertRule{expr: expr}
+	terms := strings.Fields(expr)
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		switch {
+		case strings.HasPrefix(term, "ns="):
+			r.ns = strings.TrimPrefix(term, "ns=")
+			if _, err := path.Match(r.ns, ""); err != nil {
+				return nil, fmt.Errorf("Invalid namespace pattern '%v' in alert '%v'", r.ns, expr)
+			}
+		case alertCondRe.MatchString(term):
+			m := alertCondRe.FindStringSubmatch(term)
+			th, err := strconv.ParseFloat(m[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid threshold '%v' in alert '%v'", m[2], expr)
+			}
+			r.op = m[1]
+			r.threshold = th
+		case term == "for":
+			if i+1 >= len(terms) {
+				return nil, fmt.Errorf("Missing duration after 'for' in alert '%v'", expr)
+			}
+			i++
+			d, err := time.ParseDuration(terms[i])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid duration '%v' in alert '%v'", terms[i], expr)
+			}
+			r.hold = d
+		default:
+			return nil, fmt.Errorf("Unknown term '%v' in alert '%v'", term, expr)
+		}
+	}
+	if r.op == "" {
+		return nil, fmt.Errorf("Alert '%v' has no value condition (e.g. value>4)", expr)
+	}
+	return r, nil
+}
+
+func (r *alertRule) matches(ns string) bool {
+	if r.ns == "" {
+		return true
+	}
+	ok, _ := path.Match(r.ns, ns)
+	return ok
+}
+
+func (r *alertRule) holds(v float64) bool {
+	switch r.op {
+	case ">":
+		return v > r.threshold
+	case ">=":
+		return v >= r.threshold
+	case "<":
+		return v < r.threshold
+	case "<=":
+		return v <= r.threshold
+	case "==":
+		return v == r.threshold
+	case "!=":
+		return v != r.threshold
+	}
+	return false
+}
+
+// alertState tracks one rule for one series (namespace and tags).
+type alertState struct {
+	firing bool
+	// time the condition started to hold while not firing, or started to
+	// clear while firing; zero when there is no pending transition
+	pendingSince time.Time
+	since        time.Time
+}
+
+// alertEvent is passed to the alert hook as JSON on stdin.
+type alertEvent struct {
+	State     string            `json:"state"`
+	Rule      string            `json:"rule"`
+	TaskID    string            `json:"task_id"`
+	Namespace string            `json:"namespace"`
+	Value     interface{}       `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Since     time.Time         `json:"since"`
+}
+
+type alertManager struct {
+	taskID string
+	rules  []*alertRule
+	hook   string
+	states map[string]*alertState
+}
+
+func newAlertManager(taskID string, rules []*alertRule, hook string) *alertManager {
+	return &alertManager{
+		taskID: taskID,
+		rules:  rules,
+		hook:   hook,
+		states: map[string]*alertState{},
+	}
+}
+
+// handle evaluates all rules against the metrics of a single stream event.
+func (am *alertManager) handle(tskEvent *models.StreamedTaskEvent) error {
+	now := time.Now()
+	for _, e := range tskEvent.Event {
+		v, ok := toFloat(e.Data)
+		if !ok {
+			continue
+		}
+		series := e.Namespace + "{" + strings.Join(sortTags(e.Tags), ",") + "}"
+		for i, r := range am.rules {
+			if !r.matches(e.Namespace) {
+				continue
+			}
+			key := strconv.Itoa(i) + series
+			st, ok := am.states[key]
+			if !ok {
+				st = &alertState{}
+				am.states[key] = st
+			}
+			state := st.update(r.holds(v), r.hold, now)
+			if state == "" {
+				continue
+			}
+			am.notify(alertEvent{
+				State:     state,
+				Rule:      r.expr,
+				TaskID:    am.taskID,
+				Namespace: e.Namespace,
+				Value:     e.Data,
+				Timestamp: time.Time(e.Timestamp),
+				Tags:      e.Tags,
+				Since:     st.since,
+			})
+		}
+	}
+	return nil
+}
+
+// update records an observation and returns the new state of the alert
+// if it transitioned, otherwise an empty string.
+func (st *alertState) update(cond bool, hold time.Duration, now time.Time) string {
+	// nothing is pending when the observation agrees with the current state
+	if cond == st.firing {
+		st.pendingSince = time.Time{}
+		return ""
+	}
+	if st.pendingSince.IsZero() {
+		st.pendingSince = now
+	}
+	if now.Sub(st.pendingSince) < hold {
+		return ""
+	}
+	st.firing = cond
+	st.since = st.pendingSince
+	st.pendingSince = time.Time{}
+	if st.firing {
+		return alertFiring
+	}
+	return alertResolved
+}
+
+func (am *alertManager) notify(ae alertEvent) {
+	fmt.Printf("%s %s %s=%v [%s] (%s)\n",
+		ae.Timestamp.Format(time.RFC3339),
+		strings.ToUpper(ae.State),
+		ae.Namespace,
+		ae.Value,
+		strings.Join(sortTags(ae.Tags), ", "),
+		ae.Rule,
+	)
+	if am.hook == "" {
+		return
+	}
+	if err := runAlertHook(am.hook, ae); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running alert hook '%s': %v\n", am.hook, err)
+	}
+}
+
+// runAlertHook runs the hook through the shell, passing the alert as JSON on
+// stdin and its main fields as SNAPTEL_* environment variables.
+func runAlertHook(hook string, ae alertEvent) error {
+	b, err := json.Marshal(ae)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook)
+	} else {
+		cmd = exec.Command("sh", "-c", hook)
+	}
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SNAPTEL_ALERT_STATE="+ae.State,
+		"SNAPTEL_ALERT_RULE="+ae.Rule,
+		"SNAPTEL_ALERT_SINCE="+ae.Since.Format(time.RFC3339),
+		"SNAPTEL_TASK_ID="+ae.TaskID,
+		"SNAPTEL_METRIC_NAMESPACE="+ae.Namespace,
+		fmt.Sprintf("SNAPTEL_METRIC_VALUE=%v", ae.Value),
+		"SNAPTEL_METRIC_TIMESTAMP="+ae.Timestamp.Format(time.RFC3339Nano),
+		"SNAPTEL_METRIC_TAGS="+strings.Join(sortTags(ae.Tags), ","),
+	)
+	return cmd.Run()
+}
+
+// toFloat converts the data of a streamed metric into a float value.
+func toFloat(data interface{}) (float64, bool) {
+	switch v := data.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
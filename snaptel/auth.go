@@ -0,0 +1,158 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/urfave/cli"
+)
+
+// requestAuth writes to the requests to snap the headers given with --header
+// and the config file, and the bearer token given with --token or
+// --token-file instead of the password, for daemons behind an API gateway.
+type requestAuth struct {
+	headers http.Header
+	token   string
+	basic   runtime.ClientAuthInfoWriter
+	err     error // failing every request, like a token file not found
+}
+
+// AuthInfo returns the runtime.ClientAuthInfoWriter of the requests to snap:
+// the headers and the bearer token, or else the password of BasicAuth. It is
+// nil when none is given.
+func AuthInfo(ctx *cli.Context) runtime.ClientAuthInfoWriter {
+	cfg, err := getCLIConfig(ctx)
+	if err != nil {
+		cfg = &config{}
+	}
+	a := &requestAuth{headers: http.Header{}}
+	for name, v := range cfg.Headers {
+		a.headers.Set(name, v)
+	}
+	for _, h := range ctx.StringSlice("header") {
+		name, v, err := parseHeader(h)
+		if err != nil {
+			a.err = err
+			break
+		}
+		a.headers.Set(name, v)
+	}
+
+	tokenFile := ctx.String("token-file")
+	if tokenFile == "" && cfg.Auth != nil {
+		tokenFile = cfg.Auth.TokenFile
+	}
+	switch {
+	case ctx.String("token") != "":
+		a.token = ctx.String("token")
+	case tokenFile != "":
+		b, err := ioutil.ReadFile(expandHome(tokenFile))
+		if err != nil && a.err == nil {
+			a.err = fmt.Errorf("Error reading the token file: %v", err)
+		}
+		a.token = strings.TrimSpace(string(b))
+	default:
+		a.basic = BasicAuth(ctx)
+	}
+
+	if len(a.headers) == 0 && a.token == "" && a.basic == nil && a.err == nil {
+		return nil
+	}
+	return a
+}
+
+// parseHeader splits a header given as "Name: value".
+func parseHeader(h string) (string, string, error) {
+	i := strings.Index(h, ":")
+	if i < 0 || strings.TrimSpace(h[:i]) == "" {
+		return "", "", fmt.Errorf("Error: bad header '%s' (expected 'Name: value')", h)
+	}
+	return http.CanonicalHeaderKey(strings.TrimSpace(h[:i])), strings.TrimSpace(h[i+1:]), nil
+}
+
+// AuthenticateRequest writes the headers and the credentials to a request of
+// the API client.
+func (a *requestAuth) AuthenticateRequest(r runtime.ClientRequest, reg strfmt.Registry) error {
+	if a.err != nil {
+		return a.err
+	}
+	for name, values := range a.headers {
+		if err := r.SetHeaderParam(name, values...); err != nil {
+			return err
+		}
+	}
+	if a.token != "" {
+		return r.SetHeaderParam("Authorization", "Bearer "+a.token)
+	}
+	if a.basic != nil {
+		return a.basic.AuthenticateRequest(r, reg)
+	}
+	return nil
+}
+
+// authenticateRequest writes the headers and the credentials to a request sent
+// outside of the API client, like the event stream of watch.
+func authenticateRequest(req *http.Request) error {
+	a, _ := authInfoWriter.(*requestAuth)
+	if a == nil {
+		req.SetBasicAuth("snap", password)
+		return nil
+	}
+	if a.err != nil {
+		return a.err
+	}
+	for name, values := range a.headers {
+		req.Header[name] = values
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else {
+		req.SetBasicAuth("snap", password)
+	}
+	return nil
+}
+
+// authToken returns the bearer token of the requests to snap, if any.
+func authToken() string {
+	if a, ok := authInfoWriter.(*requestAuth); ok {
+		return a.token
+	}
+	return ""
+}
+
+// authHeaders returns the headers of the requests to snap, if any.
+func authHeaders() http.Header {
+	if a, ok := authInfoWriter.(*requestAuth); ok {
+		return a.headers
+	}
+	return nil
+}
+
+// hasPasswordAuth tells whether the password of the REST API is sent.
+func hasPasswordAuth() bool {
+	a, ok := authInfoWriter.(*requestAuth)
+	return ok && a.basic != nil
+}
@@ -0,0 +1,32 @@
+//go:build go1.20
+// +build go1.20
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import "crypto/tls"
+
+// isCertificateVerificationError tells whether err is the failure to verify
+// the certificate of the daemon, which the TLS handshake wraps since Go 1.20.
+func isCertificateVerificationError(err error) bool {
+	_, ok := err.(*tls.CertificateVerificationError)
+	return ok
+}
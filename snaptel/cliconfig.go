@@ -0,0 +1,538 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/urfave/cli"
+)
+
+// maxAliasDepth bounds the expansion of aliases defined with other aliases.
+const maxAliasDepth = 10
+
+// config is the snaptel configuration file, in YAML (of which JSON, the
+// former format, is a subset). It is given with --config, or else read from
+// config.yaml in $XDG_CONFIG_HOME/snaptel or ~/.config/snaptel when it exists:
+//
+//	url: https://snap.example.com:8181
+//	api-version: v2
+//	insecure: false
+//	timeout: 30s
+//	output: json
+//	retries: 3
+//	retry-backoff: 1s
+//	proxy: http://proxy.example.com:3128
+//	headers:
+//	  X-Tenant: lab
+//	tls:
+//	  ca-cert: /etc/snap/ca.crt
+//	  cert: /etc/snap/snaptel.crt
+//	  key: /etc/snap/snaptel.key
+//	auth:
+//	  password-file: ~/.snap/password
+//	aliases:
+//	  tl: task list --verbose
+//	  load: plugin load --plugin-cert /etc/snap/plugin.crt --plugin-key /etc/snap/plugin.key
+//	defaults:
+//	  metric list:
+//	    verbose: true
+//	  plugin load:
+//	    timeout: 30s
+//
+// The settings of the global flags apply unless the flags are given on the
+// command line or in the environment. An alias is run with the arguments
+// following it. Defaults are the default values of the flags of a command,
+// given by the names of the commands leading to it; the global flags can be
+// given too.
+type config struct {
+	URL          string                            `yaml:"url,omitempty"`
+	APIVersion   string                            `yaml:"api-version,omitempty"`
+	Insecure     *bool                             `yaml:"insecure,omitempty"`
+	Timeout      string                            `yaml:"timeout,omitempty"`
+	Output       string                            `yaml:"output,omitempty"`
+	Retries      *int                              `yaml:"retries,omitempty"`
+	RetryBackoff string                            `yaml:"retry-backoff,omitempty"`
+	Proxy        string                            `yaml:"proxy,omitempty"`
+	Headers      map[string]string                 `yaml:"headers,omitempty"`
+	TLS          *tlsConfig                        `yaml:"tls,omitempty"`
+	Auth         *authConfig                       `yaml:"auth,omitempty"`
+	RestAPI      *restAPIConfig                    `yaml:"rest,omitempty"`
+	Aliases      map[string]string                 `yaml:"aliases,omitempty"`
+	Defaults     map[string]map[string]interface{} `yaml:"defaults,omitempty"`
+}
+
+// tlsConfig holds the files of the TLS client: the CA certificate verifying
+// the server, and the certificate and key presented to it, which may be in a
+// single file.
+type tlsConfig struct {
+	CACert string `yaml:"ca-cert,omitempty"`
+	Cert   string `yaml:"cert,omitempty"`
+	Key    string `yaml:"key,omitempty"`
+}
+
+// authConfig is the source of the password of the REST API: prompted for like
+// with --password, or given as is, in a file or in an environment variable.
+// A bearer token file, like --token-file, is sent instead of the password.
+type authConfig struct {
+	Prompt       bool    `yaml:"prompt,omitempty"`
+	Password     *string `yaml:"password,omitempty"`
+	PasswordFile string  `yaml:"password-file,omitempty"`
+	PasswordEnv  string  `yaml:"password-env,omitempty"`
+	TokenFile    string  `yaml:"token-file,omitempty"`
+}
+
+// restAPIConfig is the password setting of the former JSON config files,
+// replaced by auth.password.
+type restAPIConfig struct {
+	Password *string `yaml:"rest-auth-pwd,omitempty"`
+}
+
+var (
+	// cliConfig is loaded once, commands run by aliases and by the shell
+	// sharing it
+	cliConfig  *config
+	aliasDepth int
+	// globalFlagArgs are the global flags given to the running command, which
+	// aliases and the shell pass on to the commands they run
+	globalFlagArgs []string
+)
+
+func (c *config) loadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read config. File might not exist")
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		if me, ok := yamlSyntaxError(err).(*manifestError); ok {
+			me.file = path
+			return fmt.Errorf("Invalid config: %v", me)
+		}
+		return fmt.Errorf("Invalid config: %v", err)
+	}
+	return nil
+}
+
+// hasPassword tells whether the config gives the password of the REST API, or
+// asks for it.
+func (c *config) hasPassword() bool {
+	if c.RestAPI != nil && c.RestAPI.Password != nil {
+		return true
+	}
+	a := c.Auth
+	return a != nil && (a.Prompt || a.Password != nil || a.PasswordFile != "" || a.PasswordEnv != "")
+}
+
+// password returns the password of the REST API given by the config, if any.
+func (c *config) password() (string, bool, error) {
+	if a := c.Auth; a != nil {
+		switch {
+		case a.Password != nil:
+			return *a.Password, true, nil
+		case a.PasswordFile != "":
+			b, err := ioutil.ReadFile(expandHome(a.PasswordFile))
+			if err != nil {
+				return "", false, fmt.Errorf("Error reading the password file: %v", err)
+			}
+			return strings.TrimRight(string(b), "\r\n"), true, nil
+		case a.PasswordEnv != "":
+			p, ok := os.LookupEnv(a.PasswordEnv)
+			if !ok {
+				return "", false, fmt.Errorf("Error: the password variable $%s is not set", a.PasswordEnv)
+			}
+			return p, true, nil
+		}
+	}
+	if c.RestAPI != nil && c.RestAPI.Password != nil {
+		return *c.RestAPI.Password, true, nil
+	}
+	return "", false, nil
+}
+
+// globalSettings returns the values of the global flags set by the config, by
+// flag name.
+func (c *config) globalSettings() map[string]string {
+	settings := map[string]string{}
+	if c.URL != "" {
+		settings["url"] = c.URL
+	}
+	if c.APIVersion != "" {
+		settings["api-version"] = c.APIVersion
+	}
+	if c.Insecure != nil {
+		settings["insecure"] = strconv.FormatBool(*c.Insecure)
+	}
+	if c.Timeout != "" {
+		settings["timeout"] = c.Timeout
+	}
+	if c.Output != "" {
+		settings["output"] = c.Output
+	}
+	if c.Retries != nil {
+		settings["retries"] = strconv.Itoa(*c.Retries)
+	}
+	if c.RetryBackoff != "" {
+		settings["retry-backoff"] = c.RetryBackoff
+	}
+	if c.Proxy != "" {
+		settings["proxy"] = c.Proxy
+	}
+	return settings
+}
+
+// getCLIConfig returns the configuration, loading it from the file given with
+// --config, or else from the default one, the first time.
+func getCLIConfig(ctx *cli.Context) (*config, error) {
+	return loadCLIConfig(ctx.GlobalString("config"))
+}
+
+func loadCLIConfig(path string) (*config, error) {
+	if cliConfig != nil {
+		return cliConfig, nil
+	}
+	cfg := &config{}
+	if path == "" {
+		// the default config file is optional
+		if _, err := os.Stat(defaultConfigPath()); err == nil {
+			path = defaultConfigPath()
+		}
+	}
+	if path != "" {
+		if err := cfg.loadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	cliConfig = cfg
+	return cfg, nil
+}
+
+// defaultConfigPath returns the config file read when none is given:
+// $XDG_CONFIG_HOME/snaptel/config.yaml or ~/.config/snaptel/config.yaml.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "snaptel", "config.yaml")
+}
+
+// expandHome replaces a leading ~/ of a path with the home directory.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	return path
+}
+
+// TLSFiles returns the CA certificate, certificate and key files of the TLS
+// client set by the config file, with the home directory expanded. The key
+// defaults to the certificate file.
+func TLSFiles(ctx *cli.Context) (caCert, cert, key string, err error) {
+	cfg, err := getCLIConfig(ctx)
+	if err != nil || cfg.TLS == nil {
+		return "", "", "", err
+	}
+	t := *cfg.TLS
+	if t.Cert == "" && t.Key != "" {
+		return "", "", "", fmt.Errorf("Invalid config: tls.key is given without tls.cert")
+	}
+	if t.Key == "" {
+		// a PEM file holding both
+		t.Key = t.Cert
+	}
+	for _, p := range []*string{&t.CACert, &t.Cert, &t.Key} {
+		if *p != "" {
+			*p = expandHome(*p)
+		}
+	}
+	return t.CACert, t.Cert, t.Key, nil
+}
+
+// ConfigPath returns the config file given with the global flag --config in
+// args, the arguments of snaptel whose global flags are flags, or else with
+// its environment variables, or "" for the default one. It is meant for the
+// setup of the app, before the flags are parsed.
+func ConfigPath(flags []cli.Flag, args []string) string {
+	for i := 0; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		f := findFlag([]cli.Flag{FlConfig}, args[i])
+		if f == nil {
+			if g := findFlag(flags, args[i]); g != nil && flagTakesValue(g) && !strings.Contains(args[i], "=") {
+				i++
+			}
+			continue
+		}
+		if j := strings.Index(args[i], "="); j >= 0 {
+			return args[i][j+1:]
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	for _, env := range strings.Split(FlConfig.EnvVar, ",") {
+		if v := os.Getenv(strings.TrimSpace(env)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// AliasCommands returns a command for every alias of the config file at path,
+// running its expansion.
+func AliasCommands(path string, cmds []cli.Command) ([]cli.Command, error) {
+	cfg, err := loadCLIConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Aliases))
+	for name := range cfg.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]cli.Command, 0, len(names))
+	for _, name := range names {
+		expansion := cfg.Aliases[name]
+		if findCommand(cmds, name) != nil {
+			return nil, fmt.Errorf("Invalid config: alias '%s' is the name of a command", name)
+		}
+		words, err := splitCommandLine(expansion)
+		if err != nil || len(words) == 0 {
+			return nil, fmt.Errorf("Invalid config: bad alias '%s': '%s'", name, expansion)
+		}
+		out = append(out, cli.Command{
+			Name:            name,
+			Usage:           "Alias for " + expansion,
+			Category:        "aliases",
+			SkipFlagParsing: true,
+			HideHelp:        true,
+			Action:          runAlias(words),
+		})
+	}
+	return out, nil
+}
+
+// ApplyConfig applies the configuration file to the command about to run: it
+// sets the defaults of the flags of the command, before they are parsed, and
+// the global flags given neither on the command line nor in the environment.
+// It is run before every command.
+func ApplyConfig(ctx *cli.Context) error {
+	globalFlagArgs = givenGlobalFlags(ctx)
+	cfg, err := getCLIConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	var path []string
+	var cmd *cli.Command
+	cmds := ctx.App.Commands
+	for _, a := range ctx.Args() {
+		c := findCommand(cmds, a)
+		if c == nil {
+			break
+		}
+		path, cmd, cmds = append(path, c.Name), c, c.Subcommands
+	}
+	if cmd != nil {
+		defaults := cfg.Defaults[strings.Join(path, " ")]
+		if err := applyDefaults(ctx, cmd, defaults); err != nil {
+			return fmt.Errorf("Invalid config: defaults of '%s': %v", strings.Join(path, " "), err)
+		}
+	}
+	settings := cfg.globalSettings()
+	for _, f := range ctx.App.Flags {
+		name := flagName(f)
+		v, ok := settings[name]
+		if !ok || ctx.IsSet(name) || flagInEnv(f) {
+			continue
+		}
+		if err := ctx.Set(name, v); err != nil {
+			return fmt.Errorf("Invalid config: %s: %v", name, err)
+		}
+	}
+	if ctx.IsSet("timeout") {
+		FlTimeout.Value = ctx.Duration("timeout")
+	}
+	switch o := ctx.String("output"); o {
+	case "text", "json":
+		outputFormat = o
+	default:
+		return fmt.Errorf("Error: unsupported output format '%s' (expected text or json)", o)
+	}
+	return nil
+}
+
+// runAlias runs the app again with the expansion of an alias followed by the
+// arguments given to it. The client is already set up, only the
+// configuration is applied before the command.
+func runAlias(words []string) func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if aliasDepth >= maxAliasDepth {
+			return fmt.Errorf("Error: aliases nested more than %d levels deep", maxAliasDepth)
+		}
+		aliasDepth++
+		defer func() { aliasDepth-- }()
+
+		app := ctx.App
+		before := app.Before
+		app.Before = ApplyConfig
+		defer func() { app.Before = before }()
+		defer func(args []string) { globalFlagArgs = args }(globalFlagArgs)
+		args := append([]string{app.Name}, globalFlagArgs...)
+		args = append(append(args, words...), ctx.Args()...)
+		return app.Run(args)
+	}
+}
+
+// givenGlobalFlags returns the global flags given on the command line or in
+// the environment, before the config file is applied, as arguments.
+func givenGlobalFlags(ctx *cli.Context) []string {
+	var args []string
+	for _, f := range ctx.App.Flags {
+		name := flagName(f)
+		if !ctx.IsSet(name) {
+			continue
+		}
+		if _, ok := f.(cli.StringSliceFlag); ok {
+			for _, v := range ctx.StringSlice(name) {
+				args = append(args, "--"+name+"="+v)
+			}
+			continue
+		}
+		args = append(args, "--"+name+"="+fmt.Sprint(ctx.Generic(name)))
+	}
+	return args
+}
+
+// applyDefaults sets the default values of the flags of a command. The global
+// flags which are not given on the command line are set instead.
+func applyDefaults(ctx *cli.Context, cmd *cli.Command, defaults map[string]interface{}) error {
+	for name, v := range defaults {
+		found := false
+		for i, f := range cmd.Flags {
+			if findFlag([]cli.Flag{f}, name) == nil {
+				continue
+			}
+			nf, err := flagWithDefault(f, v)
+			if err != nil {
+				return fmt.Errorf("flag '%s': %v", name, err)
+			}
+			cmd.Flags[i], found = nf, true
+			break
+		}
+		if found {
+			continue
+		}
+		if findFlag(ctx.App.Flags, name) == nil {
+			return fmt.Errorf("unknown flag '%s'", name)
+		}
+		if !ctx.IsSet(name) {
+			if err := ctx.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("flag '%s': %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// flagWithDefault returns a copy of a flag with a new default value. A
+// boolean flag defaulting to true becomes a BoolTFlag.
+func flagWithDefault(f cli.Flag, v interface{}) (cli.Flag, error) {
+	s := fmt.Sprint(v)
+	switch x := f.(type) {
+	case cli.StringFlag:
+		x.Value = s
+		return x, nil
+	case cli.IntFlag:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an integer", s)
+		}
+		x.Value = n
+		return x, nil
+	case cli.DurationFlag:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		x.Value = d
+		return x, nil
+	case cli.BoolFlag, cli.BoolTFlag:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", s)
+		}
+		name, usage, env := boolFlagFields(x)
+		if b {
+			return cli.BoolTFlag{Name: name, Usage: usage, EnvVar: env}, nil
+		}
+		return cli.BoolFlag{Name: name, Usage: usage, EnvVar: env}, nil
+	case cli.StringSliceFlag:
+		var values cli.StringSlice
+		if l, ok := v.([]interface{}); ok {
+			for _, e := range l {
+				values = append(values, fmt.Sprint(e))
+			}
+		} else {
+			values = cli.StringSlice{s}
+		}
+		x.Value = &values
+		return x, nil
+	}
+	return nil, fmt.Errorf("defaults are not supported for this flag")
+}
+
+func boolFlagFields(f cli.Flag) (string, string, string) {
+	switch x := f.(type) {
+	case cli.BoolFlag:
+		return x.Name, x.Usage, x.EnvVar
+	case cli.BoolTFlag:
+		return x.Name, x.Usage, x.EnvVar
+	}
+	return "", "", ""
+}
+
+// flagInEnv tells whether a flag is given by one of its environment variables.
+func flagInEnv(f cli.Flag) bool {
+	var envVar string
+	switch x := f.(type) {
+	case cli.StringFlag:
+		envVar = x.EnvVar
+	case cli.BoolFlag:
+		envVar = x.EnvVar
+	case cli.IntFlag:
+		envVar = x.EnvVar
+	case cli.DurationFlag:
+		envVar = x.EnvVar
+	}
+	for _, env := range strings.Split(envVar, ",") {
+		if env = strings.TrimSpace(env); env != "" && os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/intelsdi-x/snap-client-go/client/tasks"
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+// configPathElem is a step of a --set-config path: a key of an object or an
+// index of an array.
+type configPathElem struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+func cloneTask(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Incorrect usage", ctx)
+	}
+	src, err := findTask(ctx, ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	params := tasks.NewGetTaskParamsWithTimeout(FlTimeout.Value)
+	params.SetID(src.ID)
+	resp, err := client.Tasks.GetTask(params, authInfoWriter)
+	if err != nil {
+		return getErrorDetail(err)
+	}
+	orig := resp.Payload
+
+	// keep what a task manifest holds, snap names the copy unless --name is given
+	t := models.Task{
+		Version:            1,
+		Schedule:           orig.Schedule,
+		Workflow:           orig.Workflow,
+		Deadline:           orig.Deadline,
+		MaxFailures:        orig.MaxFailures,
+		MaxCollectDuration: orig.MaxCollectDuration,
+		MaxMetricsBuffer:   orig.MaxMetricsBuffer,
+	}
+	if t.Schedule == nil {
+		t.Schedule = &models.Schedule{}
+	}
+
+	if edits := ctx.StringSlice("set-config"); len(edits) > 0 {
+		wf, err := setWorkflowConfig(t.Workflow, edits)
+		if err != nil {
+			return newUsageError(err.Error(), ctx)
+		}
+		t.Workflow = wf
+	}
+
+	tsk, err := toTaskJSON(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	addParams := tasks.NewAddTaskParamsWithTimeout(FlTimeout.Value)
+	addParams.SetTask(tsk)
+	addResp, err := client.Tasks.AddTask(addParams, authInfoWriter)
+	if err != nil {
+		return getErrorDetail(err)
+	}
+	res := addResp.Payload
+	fmt.Printf("Task cloned from %s\n", orig.ID)
+	fmt.Printf("ID: %s\n", res.ID)
+	fmt.Printf("Name: %s\n", res.Name)
+	fmt.Printf("State: %s\n", res.TaskState)
+	return nil
+}
+
+// findTask returns the task with the given ID or, failing that, the only task
+// with the given name.
+func findTask(ctx *cli.Context, idOrName string) (*models.Task, error) {
+	tsks, err := fetchTasks()
+	if err != nil {
+		return nil, getErrorDetail(err)
+	}
+	var named []*models.Task
+	for _, t := range tsks {
+		if t.ID == idOrName {
+			return t, nil
+		}
+		if t.Name == idOrName {
+			named = append(named, t)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return nil, fmt.Errorf("Error: no task with the ID or name '%s'", idOrName)
+	case 1:
+		return named[0], nil
+	}
+	ids := make([]string, 0, len(named))
+	for _, t := range named {
+		ids = append(ids, t.ID)
+	}
+	return nil, fmt.Errorf("Error: %d tasks are named '%s', use one of their IDs: %s", len(named), idOrName, strings.Join(ids, ", "))
+}
+
+// setWorkflowConfig applies path=value edits to a workflow. A path goes from
+// the root of the workflow through object keys and array indexes, e.g.
+//
+//	collect.process[0].publish[0].config.file=/tmp/debug.log
+//	collect.config["/intel/mock"].user=root
+//
+// The value is a JSON literal (number, boolean, null, quoted string, object or
+// array) or, when it is not one, a plain string.
+func setWorkflowConfig(wf *models.WorkflowMap, edits []string) (*models.WorkflowMap, error) {
+	b, err := json.Marshal(wf)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, e := range edits {
+		p, v, err := splitConfigEdit(e)
+		if err != nil {
+			return nil, err
+		}
+		elems, err := parseConfigPath(p)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(v), &value); err != nil {
+			value = v
+		}
+		if doc, err = setConfigPath(doc, elems, value); err != nil {
+			return nil, fmt.Errorf("Cannot set '%s': %v", p, err)
+		}
+	}
+
+	if b, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+	out := &models.WorkflowMap{}
+	if err := json.Unmarshal(b, out); err != nil {
+		return nil, fmt.Errorf("Error parsing the edited workflow: %v", err)
+	}
+	return out, nil
+}
+
+// splitConfigEdit splits path=value at the first '=' which is not within
+// brackets.
+func splitConfigEdit(e string) (string, string, error) {
+	depth := 0
+	for i, c := range e {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '=':
+			if depth == 0 {
+				return strings.TrimPrefix(e[:i], "$."), e[i+1:], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("Bad --set-config '%s', expected <path>=<value>", e)
+}
+
+func parseConfigPath(p string) ([]configPathElem, error) {
+	var elems []configPathElem
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.Index(p[i:], "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Bad path '%s': missing ']'", p)
+			}
+			in := p[i+1 : i+end]
+			i += end + 1
+			if k, err := strconv.Unquote(in); err == nil {
+				elems = append(elems, configPathElem{key: k})
+				continue
+			}
+			n, err := strconv.Atoi(in)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Bad path '%s': '[%s]' is neither an index nor a quoted key", p, in)
+			}
+			elems = append(elems, configPathElem{index: n, isIdx: true})
+		default:
+			end := strings.IndexAny(p[i:], ".[")
+			if end < 0 {
+				end = len(p) - i
+			}
+			elems = append(elems, configPathElem{key: p[i : i+end]})
+			i += end
+		}
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("Bad path '%s'", p)
+	}
+	return elems, nil
+}
+
+// setConfigPath sets the value at the path, creating the missing objects on
+// the way, and returns the updated node.
+func setConfigPath(node interface{}, path []configPathElem, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	e := path[0]
+	if e.isIdx {
+		l, ok := node.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index a value which is not an array with [%d]", e.index)
+		}
+		if e.index >= len(l) {
+			return nil, fmt.Errorf("index %d is out of range (%d elements)", e.index, len(l))
+		}
+		v, err := setConfigPath(l[e.index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		l[e.index] = v
+		return l, nil
+	}
+
+	m, ok := node.(map[string]interface{})
+	if node == nil {
+		m, ok = map[string]interface{}{}, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot get the key '%s' of a value which is not an object", e.key)
+	}
+	v, err := setConfigPath(m[e.key], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	m[e.key] = v
+	return m, nil
+}
@@ -41,27 +41,72 @@ var (
 					Flags: []cli.Flag{
 						flTaskManifest,
 						flWorkfowManifest,
+						flTaskManifestFormat,
 						flTaskSchedInterval,
 						flTaskSchedCount,
 						flTaskSchedStartDate,
 						flTaskSchedStartTime,
 						flTaskSchedStopDate,
 						flTaskSchedStopTime,
+						flTaskSchedStart,
+						flTaskSchedStop,
+						flTaskSchedTimeZone,
 						flTaskName,
 						flTaskSchedDuration,
 						flTaskSchedNoStart,
 						flTaskDeadline,
 						flTaskMaxFailures,
+						flTaskSchedStreaming,
+						flTaskMaxCollectDuration,
+						flTaskMaxMetricsBuffer,
+						flTaskCreateRollback,
+					},
+				},
+				{
+					Name:   "init",
+					Usage:  "init [<file>] [-m <namespace_glob>...] [--processor <name>[:<version>]...] [--publisher <name>[:<version>]...] [-i 1s]",
+					Action: initTask,
+					Flags: []cli.Flag{
+						flTaskInitMetric,
+						flTaskInitProcessor,
+						flTaskInitPublisher,
+						flTaskInitInterval,
+						flTaskName,
+						flTaskInitForce,
+					},
+				},
+				{
+					Name:   "clone",
+					Usage:  "clone <task_id>|<task_name> [--name <name>] [--interval <interval>] [--set-config <path>=<value>...] [--no-start]",
+					Action: cloneTask,
+					Flags: []cli.Flag{
+						flTaskName,
+						flTaskSchedInterval,
+						flTaskSchedCount,
+						flTaskSchedStartDate,
+						flTaskSchedStartTime,
+						flTaskSchedStopDate,
+						flTaskSchedStopTime,
+						flTaskSchedStart,
+						flTaskSchedStop,
+						flTaskSchedTimeZone,
+						flTaskSchedDuration,
+						flTaskSchedNoStart,
+						flTaskDeadline,
+						flTaskMaxFailures,
+						flTaskMaxCollectDuration,
+						flTaskMaxMetricsBuffer,
+						flTaskCloneSetConfig,
 					},
 				},
 				{
 					Name:   "list",
-					Usage:  "list or list --verbose",
+					Usage:  "list or list --verbose or list --watch [--interval 2s]",
 					Action: listTask,
 					Flags: []cli.Flag{
 						flTaskManifest,
 						flWorkfowManifest,
-						flTaskSchedInterval,
+						flTaskListInterval,
 						flTaskSchedCount,
 						flTaskSchedStartDate,
 						flTaskSchedStartTime,
@@ -72,6 +117,8 @@ var (
 						flTaskSchedNoStart,
 						flTaskDeadline,
 						flTaskMaxFailures,
+						flVerbose,
+						flTaskListWatch,
 					},
 				},
 				{
@@ -94,12 +141,23 @@ var (
 					Usage:  "export <task_id>",
 					Action: exportTask,
 				},
+				{
+					Name:   "graph",
+					Usage:  "graph <task_id> or graph -t <manifest> [--format ascii|dot|mermaid]",
+					Action: graphTask,
+					Flags: []cli.Flag{
+						flTaskGraphManifest,
+						flTaskGraphFormat,
+					},
+				},
 				{
 					Name:   "watch",
-					Usage:  "watch <task_id> or watch <task_id> --verbose",
+					Usage:  "watch <task_id> or watch <task_id> --verbose or watch <task_id> --alert <rule> [--exec <command>]",
 					Action: watchTask,
 					Flags: []cli.Flag{
 						flVerbose,
+						flWatchAlert,
+						flWatchExec,
 					},
 				},
 				{
@@ -107,6 +165,31 @@ var (
 					Usage:  "enable <task_id>",
 					Action: enableTask,
 				},
+				{
+					Name: "schedule",
+					Subcommands: []cli.Command{
+						{
+							Name:   "preview",
+							Usage:  "preview -t <task_manifest>|<task_id> [-n 10] or preview --interval <interval> [--start <time>] [--stop <time>] [--count <count>]",
+							Action: previewSchedule,
+							Flags: []cli.Flag{
+								flSchedulePreviewTask,
+								flSchedulePreviewNumber,
+								flTaskManifestFormat,
+								flTaskSchedInterval,
+								flTaskSchedCount,
+								flTaskSchedStartDate,
+								flTaskSchedStartTime,
+								flTaskSchedStopDate,
+								flTaskSchedStopTime,
+								flTaskSchedStart,
+								flTaskSchedStop,
+								flTaskSchedTimeZone,
+								flTaskSchedDuration,
+							},
+						},
+					},
+				},
 			},
 		},
 		{
@@ -153,6 +236,37 @@ var (
 				},
 			},
 		},
+		{
+			Name: "export",
+			Subcommands: []cli.Command{
+				{
+					Name:   "prometheus",
+					Usage:  "prometheus <task_id>... [--listen :9100] [--stale-after 5m]",
+					Action: exportPrometheus,
+					Flags: []cli.Flag{
+						flExportListen,
+						flExportStaleAfter,
+					},
+				},
+			},
+		},
+		{
+			Name:   "forward",
+			Usage:  "forward <task_id>... --to influx://host:8086/db|graphite://host:2003|statsd://host:8125",
+			Action: forwardTask,
+			Flags: []cli.Flag{
+				flForwardTo,
+				flForwardMap,
+				flForwardBatchSize,
+				flForwardBufferSize,
+				flForwardFlushInterval,
+			},
+		},
+		{
+			Name:   "ui",
+			Usage:  "Full-screen dashboard of tasks, running plugins and metrics",
+			Action: runUI,
+		},
 		{
 			Name: "metric",
 			Subcommands: []cli.Command{
@@ -177,6 +291,95 @@ var (
 				},
 			},
 		},
+		{
+			Name: "manifest",
+			Subcommands: []cli.Command{
+				{
+					Name:   "convert",
+					Usage:  "convert <manifest> [--to json|yaml] or convert <workflow_manifest> --wrap-workflow --interval <interval> [--to json|yaml]",
+					Action: convertManifest,
+					Flags: []cli.Flag{
+						flManifestTo,
+						flManifestWrapWorkflow,
+						flTaskSchedInterval,
+						flTaskSchedCount,
+						flTaskSchedStartDate,
+						flTaskSchedStartTime,
+						flTaskSchedStopDate,
+						flTaskSchedStopTime,
+						flTaskSchedStart,
+						flTaskSchedStop,
+						flTaskSchedTimeZone,
+						flTaskSchedDuration,
+						flTaskSchedStreaming,
+						flTaskName,
+						flTaskDeadline,
+						flTaskMaxFailures,
+						flTaskMaxCollectDuration,
+						flTaskMaxMetricsBuffer,
+					},
+				},
+				{
+					Name:   "fmt",
+					Usage:  "fmt <manifest>... [--force]",
+					Action: formatManifests,
+					Flags: []cli.Flag{
+						flManifestForce,
+					},
+				},
+				{
+					Name:   "validate",
+					Usage:  "validate <manifest>... [--workflow] [--format json|yaml]",
+					Action: validateManifests,
+					Flags: []cli.Flag{
+						flManifestWorkflow,
+						flTaskManifestFormat,
+					},
+				},
+				{
+					Name:   "schema",
+					Usage:  "schema",
+					Action: showManifestSchema,
+				},
+			},
+		},
+		{
+			Name:   "shell",
+			Usage:  "Interactive shell running snaptel commands with a single connection and login",
+			Action: runShell,
+		},
+		{
+			Name:   "completion",
+			Usage:  "completion bash|zsh|fish",
+			Action: printCompletion,
+		},
+		{
+			Name: "config",
+			Subcommands: []cli.Command{
+				{
+					Name:   "view",
+					Usage:  "view",
+					Action: viewCLIConfig,
+				},
+				{
+					Name:   "set",
+					Usage:  "set <key> <value>",
+					Action: setCLIConfig,
+				},
+				{
+					Name:   "migrate",
+					Usage:  "migrate [<old_config>]",
+					Action: migrateCLIConfig,
+				},
+			},
+		},
+		{
+			Name:            "__complete",
+			Usage:           "__complete <word>...",
+			Action:          complete,
+			Hidden:          true,
+			SkipFlagParsing: true,
+		},
 	}
 )
 
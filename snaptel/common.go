@@ -20,24 +20,21 @@ limitations under the License.
 package snaptel
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"strings"
 
 	"golang.org/x/crypto/ssh/terminal"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/go-openapi/runtime"
 	openapiclient "github.com/go-openapi/runtime/client"
 	snapClient "github.com/intelsdi-x/snap-client-go/client"
-	"github.com/intelsdi-x/snap-client-go/client/plugins"
-	"github.com/intelsdi-x/snap-client-go/client/tasks"
 	"github.com/urfave/cli"
 )
 
 var (
 	client         *snapClient.Snap
+	httpClient     *http.Client
 	authInfoWriter runtime.ClientAuthInfoWriter
 	password       string
 	scheme         string
@@ -68,6 +65,12 @@ func SetClient(cl *snapClient.Snap) {
 	client = cl
 }
 
+// SetHTTPClient sets the HTTP client used for requests made outside of the
+// API client, e.g. to download manifests.
+func SetHTTPClient(cl *http.Client) {
+	httpClient = cl
+}
+
 // SetAuthInfo sets the runtime ClientAuthInfoWriter.
 func SetAuthInfo(aw runtime.ClientAuthInfoWriter) {
 	authInfoWriter = aw
@@ -88,85 +91,15 @@ func GetFirstChar(s string) string {
 	return firstChar
 }
 
-func getErrorDetail(err error, ctx *cli.Context) error {
-	switch err.(type) {
-	case *plugins.GetMetricsNotFound:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetMetricsNotFound).Payload.ErrorMessage), ctx)
-	case *plugins.GetMetricsInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetMetricsInternalServerError).Payload.ErrorMessage), ctx)
-	case *plugins.GetMetricsUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetMetricsUnauthorized).Payload.Message), ctx)
-	case *plugins.LoadPluginBadRequest:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.LoadPluginBadRequest).Payload.ErrorMessage), ctx)
-	case *plugins.LoadPluginConflict:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.LoadPluginConflict).Payload.ErrorMessage), ctx)
-	case *plugins.LoadPluginInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.LoadPluginInternalServerError).Payload.ErrorMessage), ctx)
-	case *plugins.LoadPluginUnsupportedMediaType:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.LoadPluginUnsupportedMediaType).Payload.ErrorMessage), ctx)
-	case *plugins.LoadPluginUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.LoadPluginUnauthorized).Payload.Message), ctx)
-	case *plugins.UnloadPluginBadRequest:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.UnloadPluginBadRequest).Payload.ErrorMessage), ctx)
-	case *plugins.UnloadPluginConflict:
-		return fmt.Errorf("%v", err.(*plugins.UnloadPluginConflict).Payload.ErrorMessage)
-	case *plugins.UnloadPluginInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.UnloadPluginInternalServerError).Payload.ErrorMessage), ctx)
-	case *plugins.UnloadPluginNotFound:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.UnloadPluginNotFound).Payload.ErrorMessage), ctx)
-	case *plugins.UnloadPluginUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.UnloadPluginUnauthorized).Payload.Message), ctx)
-	case *plugins.GetPluginBadRequest:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginBadRequest).Payload.ErrorMessage), ctx)
-	case *plugins.GetPluginInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginInternalServerError).Payload.ErrorMessage), ctx)
-	case *plugins.GetPluginNotFound:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginNotFound).Payload.ErrorMessage), ctx)
-	case *plugins.GetPluginUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginUnauthorized).Payload.Message), ctx)
-	case *plugins.GetPluginsUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginsUnauthorized).Payload.Message), ctx)
-	case *plugins.GetPluginConfigItemBadRequest:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginConfigItemBadRequest).Payload.ErrorMessage), ctx)
-	case *plugins.GetPluginConfigItemUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*plugins.GetPluginConfigItemUnauthorized).Payload.Message), ctx)
-	case *tasks.GetTaskNotFound:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.GetTaskNotFound).Payload.ErrorMessage), ctx)
-	case *tasks.GetTaskUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.GetTaskUnauthorized).Payload.Message), ctx)
-	case *tasks.GetTasksUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.GetTasksUnauthorized).Payload.Message), ctx)
-	case *tasks.AddTaskInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.AddTaskInternalServerError).Payload.ErrorMessage), ctx)
-	case *tasks.AddTaskUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.AddTaskUnauthorized).Payload.Message), ctx)
-	case *tasks.UpdateTaskStateBadRequest:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.UpdateTaskStateBadRequest).Payload.ErrorMessage), ctx)
-	case *tasks.UpdateTaskStateConflict:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.UpdateTaskStateConflict).Payload.ErrorMessage), ctx)
-	case *tasks.UpdateTaskStateInternalServerError:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.UpdateTaskStateInternalServerError).Payload.ErrorMessage), ctx)
-	case *tasks.UpdateTaskStateUnauthorized:
-		return newUsageError(fmt.Sprintf("%v", err.(*tasks.UpdateTaskStateUnauthorized).Payload.Message), ctx)
-	default:
-		if strings.Contains(err.Error(), "tls: oversized record") || strings.Contains(err.Error(), "malformed HTTP response") {
-			return newUsageError(extractError(err.Error()), ctx)
-		}
-		return newUsageError(fmt.Sprintf("Error: %v", err), ctx)
-	}
-}
-
-type config struct {
-	RestAPI restAPIConfig `json:"rest"`
-}
-type restAPIConfig struct {
-	Password *string `json:"rest-auth-pwd"`
-}
-
 // checkForAuth Checks for authentication flags and returns a username/password
 // from the specified settings
 func checkForAuth(ctx *cli.Context) (username, password string) {
-	if ctx.Bool("password") {
+	cfg, err := getCLIConfig(ctx)
+	if err != nil {
+		fmt.Println(err)
+		cfg = &config{}
+	}
+	if ctx.Bool("password") || (cfg.Auth != nil && cfg.Auth.Prompt) {
 		username = "snap" // for now since username is unused but needs to exist for basicAuth
 		// Prompt for password
 		fmt.Print("Password:")
@@ -180,40 +113,19 @@ func checkForAuth(ctx *cli.Context) (username, password string) {
 		fmt.Println()
 	}
 
-	if ctx.IsSet("config") {
-		cfg := &config{}
-		if err := cfg.loadConfig(ctx.String("config")); err != nil {
-			fmt.Println(err)
-		}
-		if cfg.RestAPI.Password != nil {
-			password = *cfg.RestAPI.Password
-		} else {
-			fmt.Println("Error config password field 'rest-auth-pwd' is empty")
-		}
+	if p, ok, err := cfg.password(); err != nil {
+		fmt.Println(err)
+	} else if ok {
+		username = "snap"
+		password = p
 	}
 	return username, password
 }
 
-func (c *config) loadConfig(path string) error {
-	log.WithFields(log.Fields{
-		"_module":     "snaptel-config",
-		"_block":      "loadConfig",
-		"config_path": path,
-	}).Warning("The snaptel configuration file will be deprecated. Find more information here: https://github.com/intelsdi-x/snap/issues/1539")
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("Unable to read config. File might not exist")
-	}
-	err = json.Unmarshal(b, &c)
-	if err != nil {
-		return fmt.Errorf("Invalid config")
-	}
-	return nil
-}
-
 // BasicAuth returns the instance of runtime.ClientAuthInfoWriter.
 func BasicAuth(ctx *cli.Context) runtime.ClientAuthInfoWriter {
-	if ctx.IsSet("password") || ctx.IsSet("config") {
+	cfg, _ := getCLIConfig(ctx)
+	if ctx.IsSet("password") || (cfg != nil && cfg.hasPassword()) {
 		u, p := checkForAuth(ctx)
 		password = p
 		return openapiclient.BasicAuth(u, p)
@@ -0,0 +1,453 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-client-go/client/plugins"
+	"github.com/urfave/cli"
+)
+
+// completionCacheTTL is how long the tasks, plugins and metrics fetched for
+// completion are reused, so that repeated TABs do not query the daemon again.
+const completionCacheTTL = 10 * time.Second
+
+const bashCompletion = `# bash completion for snaptel, load it with: source <(snaptel completion bash)
+_snaptel() {
+	local cur words cword
+	if declare -F _get_comp_words_by_ref >/dev/null; then
+		_get_comp_words_by_ref -n : cur words cword
+	else
+		cur="${COMP_WORDS[COMP_CWORD]}"
+		words=("${COMP_WORDS[@]}")
+		cword=$COMP_CWORD
+	fi
+	local IFS=$'\n'
+	COMPREPLY=($(snaptel __complete "${words[@]:1:cword}" 2>/dev/null))
+	COMPREPLY=("${COMPREPLY[@]%%$'\t'*}")
+	if declare -F __ltrim_colon_completions >/dev/null; then
+		__ltrim_colon_completions "$cur"
+	fi
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace
+	fi
+}
+complete -o default -F _snaptel snaptel
+`
+
+const zshCompletion = `#compdef snaptel
+# zsh completion for snaptel, load it with: source <(snaptel completion zsh)
+_snaptel() {
+	local -a lines
+	lines=("${(@f)$(snaptel __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	lines=("${(@)lines%%$'\t'*}")
+	lines=("${(@)lines:#}")
+	if (( ${#lines} == 0 )); then
+		_files
+		return
+	fi
+	# namespace segments go on without a space
+	compadd -Q -S '' -- "${(@M)lines:#*/}"
+	compadd -Q -- "${(@)lines:#*/}"
+}
+compdef _snaptel snaptel
+`
+
+const fishCompletion = `# fish completion for snaptel, load it with: snaptel completion fish | source
+function __snaptel_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	snaptel __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c snaptel -a '(__snaptel_complete)'
+`
+
+// argCompleters complete the arguments of the commands, by the names of the
+// commands leading to them; n is the index of the argument being completed
+// and args are the arguments before it.
+var argCompleters = map[string]func(n int, args []string) []string{
+	"task start":        firstArg(completeTaskIDs),
+	"task stop":         firstArg(completeTaskIDs),
+	"task remove":       firstArg(completeTaskIDs),
+	"task enable":       firstArg(completeTaskIDs),
+	"task export":       firstArg(completeTaskIDs),
+	"task watch":        firstArg(completeTaskIDs),
+	"task graph":        firstArg(completeTaskIDs),
+	"task clone":        firstArg(completeTaskNames),
+	"export prometheus": completeTaskIDs,
+	"forward":           completeTaskIDs,
+	"plugin unload":     completePluginArgs,
+	"plugin config get": firstArg(completePluginKeys),
+}
+
+// flagCompleters complete the values of the flags, by the name of the flag.
+var flagCompleters = map[string]func(cur string) []string{
+	"metric-namespace": completeNamespaces,
+	"metric":           completeNamespaces,
+	"task":             func(string) []string { return completeTaskIDs(0, nil) },
+	"plugin-type":      func(string) []string { return pluginTypes },
+	"plugin-name":      func(string) []string { return completePluginNames("") },
+	"processor":        func(string) []string { return completePluginNames("processor") },
+	"publisher":        func(string) []string { return completePluginNames("publisher") },
+}
+
+var pluginTypes = []string{"collector", "processor", "publisher"}
+
+func printCompletion(ctx *cli.Context) error {
+	switch shell := ctx.Args().First(); shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return newUsageError(fmt.Sprintf("Unsupported shell '%s' (expected bash, zsh or fish)", shell), ctx)
+	}
+	return nil
+}
+
+// complete prints the candidates for the last word of the command line given
+// as arguments, one per line, optionally followed by a tab and a description.
+// It is run by the completion scripts, so it fails silently.
+func complete(ctx *cli.Context) error {
+	words := []string(ctx.Args())
+	// global flags of the command line configure the client: run again with
+	// them before the hidden command
+	if n := globalFlagWords(ctx.App, words); n > 0 {
+		args := append([]string{ctx.App.Name}, words[:n]...)
+		args = append(append(args, ctx.Command.Name), words[n:]...)
+		return ctx.App.Run(args)
+	}
+	for _, c := range completeWords(ctx.App, words) {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+// globalFlagWords returns the number of leading words which are global flags
+// and their values, the --password flag being dropped as it would prompt.
+func globalFlagWords(app *cli.App, words []string) int {
+	n := 0
+	for n < len(words)-1 && strings.HasPrefix(words[n], "-") {
+		f := findFlag(app.Flags, words[n])
+		if f == nil {
+			break
+		}
+		if strings.HasPrefix(f.GetName(), "password") {
+			return 0
+		}
+		n++
+		if flagTakesValue(f) && !strings.Contains(words[n-1], "=") {
+			n++
+		}
+	}
+	if n >= len(words) {
+		return 0
+	}
+	return n
+}
+
+// completeWords returns the candidates for the last word, walking the command
+// tree with the words before it.
+func completeWords(app *cli.App, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	cmds, flags := app.Commands, app.Flags
+	var path, args []string
+	var pending cli.Flag
+	for _, w := range words[:len(words)-1] {
+		switch {
+		case pending != nil:
+			pending = nil
+		case strings.HasPrefix(w, "-") && w != "-":
+			if f := findFlag(flags, w); f != nil && flagTakesValue(f) && !strings.Contains(w, "=") {
+				pending = f
+			}
+		case len(args) == 0 && findCommand(cmds, w) != nil:
+			c := findCommand(cmds, w)
+			path = append(path, c.Name)
+			cmds, flags = c.Subcommands, c.Flags
+		default:
+			args = append(args, w)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case pending != nil:
+		if fn, ok := flagCompleters[flagName(pending)]; ok {
+			candidates = fn(cur)
+		}
+	case strings.HasPrefix(cur, "-"):
+		for _, f := range flags {
+			for _, n := range strings.Split(f.GetName(), ",") {
+				if n = strings.TrimSpace(n); len(n) > 1 {
+					candidates = append(candidates, "--"+n)
+				}
+			}
+		}
+	case len(cmds) > 0 && len(args) == 0:
+		for _, c := range cmds {
+			if !c.Hidden {
+				candidates = append(candidates, c.Name)
+			}
+		}
+	default:
+		if fn, ok := argCompleters[strings.Join(path, " ")]; ok {
+			candidates = fn(len(args), args)
+		}
+	}
+
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, cur) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func findCommand(cmds []cli.Command, name string) *cli.Command {
+	for i := range cmds {
+		if cmds[i].HasName(name) {
+			return &cmds[i]
+		}
+	}
+	return nil
+}
+
+// findFlag returns the flag given by a word such as -t, --task or --task=x.
+func findFlag(flags []cli.Flag, word string) cli.Flag {
+	name := strings.TrimLeft(word, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	for _, f := range flags {
+		for _, n := range strings.Split(f.GetName(), ",") {
+			if strings.TrimSpace(n) == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// flagName is the long name of a flag.
+func flagName(f cli.Flag) string {
+	return strings.TrimSpace(strings.Split(f.GetName(), ",")[0])
+}
+
+func flagTakesValue(f cli.Flag) bool {
+	switch f.(type) {
+	case cli.BoolFlag, cli.BoolTFlag:
+		return false
+	}
+	return true
+}
+
+// firstArg restricts a completer to the first argument of a command.
+func firstArg(fn func(n int, args []string) []string) func(n int, args []string) []string {
+	return func(n int, args []string) []string {
+		if n > 0 {
+			return nil
+		}
+		return fn(n, args)
+	}
+}
+
+func completeTaskIDs(n int, args []string) []string {
+	return cachedCandidates("tasks", func() ([]string, error) {
+		tsks, err := fetchTasks()
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, t := range tsks {
+			out = append(out, t.ID+"\t"+t.Name+" ("+t.TaskState+")")
+		}
+		return out, nil
+	})
+}
+
+// completeTaskNames offers the IDs of the tasks and their names, for the
+// commands which take either.
+func completeTaskNames(n int, args []string) []string {
+	names := cachedCandidates("task-names", func() ([]string, error) {
+		tsks, err := fetchTasks()
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		seen := map[string]bool{}
+		for _, t := range tsks {
+			if t.Name != "" && !seen[t.Name] {
+				seen[t.Name] = true
+				out = append(out, t.Name+"\ttask "+t.ID)
+			}
+		}
+		return out, nil
+	})
+	return append(completeTaskIDs(n, args), names...)
+}
+
+// loadedPlugins returns the loaded plugins as type:name:version.
+func loadedPlugins() []string {
+	return cachedCandidates("plugins", func() ([]string, error) {
+		plugins, err := fetchPlugins(false)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, p := range plugins {
+			out = append(out, fmt.Sprintf("%s:%s:%d", p.Type, p.Name, p.Version))
+		}
+		return out, nil
+	})
+}
+
+func completePluginNames(typ string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range loadedPlugins() {
+		parts := strings.SplitN(p, ":", 3)
+		if len(parts) == 3 && (typ == "" || parts[0] == typ) && !seen[parts[1]] {
+			seen[parts[1]] = true
+			out = append(out, parts[1])
+		}
+	}
+	return out
+}
+
+// completePluginArgs completes the type, the name and the version of a plugin
+// given as separate arguments.
+func completePluginArgs(n int, args []string) []string {
+	switch {
+	case n == 0:
+		return pluginTypes
+	case n > 2:
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range loadedPlugins() {
+		parts := strings.SplitN(p, ":", 3)
+		if len(parts) != 3 || parts[0] != args[0] || (n == 2 && parts[1] != args[1]) {
+			continue
+		}
+		if c := parts[n]; !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func completePluginKeys(n int, args []string) []string {
+	return loadedPlugins()
+}
+
+// completeNamespaces walks the metric namespaces one segment at a time:
+// "/intel/" gives "/intel/mock/", "/intel/psutil/", and so on, a namespace
+// being given in full once its last segment is reached.
+func completeNamespaces(cur string) []string {
+	namespaces := cachedCandidates("metrics", func() ([]string, error) {
+		params := plugins.NewGetMetricsParamsWithTimeout(FlTimeout.Value)
+		resp, err := client.Plugins.GetMetrics(params, authInfoWriter)
+		if err != nil {
+			return nil, err
+		}
+		var out []string
+		for _, m := range resp.Payload.Metrics {
+			out = append(out, getNamespace(m))
+		}
+		return out, nil
+	})
+
+	depth := strings.Count(cur, "/")
+	if depth == 0 {
+		// all the namespaces share the leading "/"
+		depth = 1
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, ns := range namespaces {
+		if !strings.HasPrefix(ns, cur) {
+			continue
+		}
+		c := ns
+		if segs := strings.SplitAfter(ns, "/"); len(segs) > depth+1 {
+			c = strings.Join(segs[:depth+1], "")
+		}
+		if !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// cachedCandidates returns the candidates of the given kind cached for the
+// daemon, fetching and caching them when the cache is missing or stale.
+func cachedCandidates(kind string, fetch func() ([]string, error)) []string {
+	path := completionCachePath(kind)
+	if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) < completionCacheTTL {
+		var out []string
+		if b, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(b, &out) == nil {
+			return out
+		}
+	}
+	out, err := fetch()
+	if err != nil {
+		return nil
+	}
+	if b, err := json.Marshal(out); err == nil {
+		if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+			ioutil.WriteFile(path, b, 0600)
+		}
+	}
+	return out
+}
+
+// completionCachePath is the cache file of a kind of candidates for the
+// daemon at the URL in use, under $XDG_CACHE_HOME or ~/.cache.
+func completionCachePath(kind string) string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			home = os.TempDir()
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	sum := sha1.Sum([]byte(FlURL.Value + "|" + FlAPIVer.Value))
+	return filepath.Join(dir, "snaptel", "completion-"+fmt.Sprintf("%x", sum[:6])+"-"+kind+".json")
+}
@@ -69,7 +69,7 @@ func getConfig(ctx *cli.Context) error {
 
 	resp, err := client.Plugins.GetPluginConfigItem(params, authInfoWriter)
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return getErrorDetail(err)
 	}
 
 	printFields(w, false, 0,
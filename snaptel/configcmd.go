@@ -0,0 +1,326 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/urfave/cli"
+)
+
+// configKeyTypes are the types of the settings of the config file, by key.
+// Headers, aliases and defaults are set by headers.<name>, aliases.<name> and
+// defaults.<command>.<flag>.
+var configKeyTypes = map[string]string{
+	"url":                "string",
+	"api-version":        "string",
+	"insecure":           "bool",
+	"timeout":            "duration",
+	"output":             "output",
+	"retries":            "int",
+	"retry-backoff":      "duration",
+	"proxy":              "string",
+	"tls.ca-cert":        "string",
+	"tls.cert":           "string",
+	"tls.key":            "string",
+	"auth.prompt":        "bool",
+	"auth.password":      "string",
+	"auth.password-file": "string",
+	"auth.password-env":  "string",
+	"auth.token-file":    "string",
+}
+
+// configFilePath returns the config file given with --config, or else the
+// default one.
+func configFilePath(ctx *cli.Context) string {
+	if path := ctx.GlobalString("config"); path != "" {
+		return path
+	}
+	return defaultConfigPath()
+}
+
+func viewCLIConfig(ctx *cli.Context) error {
+	cfg, err := getCLIConfig(ctx)
+	if err != nil {
+		return err
+	}
+	path := configFilePath(ctx)
+	if _, err := os.Stat(path); err != nil {
+		path += " (not found)"
+	}
+
+	// the settings in effect, with their values from the command line and
+	// the environment, passwords hidden
+	v := *cfg
+	v.URL = ctx.GlobalString("url")
+	v.APIVersion = ctx.GlobalString("api-version")
+	insecure := ctx.GlobalBool("insecure")
+	v.Insecure = &insecure
+	v.Timeout = FlTimeout.Value.String()
+	v.Output = outputFormat
+	retries := ctx.GlobalInt("retries")
+	v.Retries = &retries
+	v.RetryBackoff = ctx.GlobalDuration("retry-backoff").String()
+	v.Proxy = ctx.GlobalString("proxy")
+	hidden := "********"
+	if v.Auth != nil && v.Auth.Password != nil {
+		a := *v.Auth
+		a.Password = &hidden
+		v.Auth = &a
+	}
+	if v.RestAPI != nil && v.RestAPI.Password != nil {
+		v.RestAPI = &restAPIConfig{Password: &hidden}
+	}
+	if len(v.Headers) > 0 {
+		v.Headers = map[string]string{}
+		for name, value := range cfg.Headers {
+			if isCredentialHeader(name) {
+				value = hidden
+			}
+			v.Headers[name] = value
+		}
+	}
+	b, err := yaml.Marshal(&v)
+	if err != nil {
+		return fmt.Errorf("Error: %v", err)
+	}
+	fmt.Printf("# %s\n%s", path, b)
+	return nil
+}
+
+func setCLIConfig(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		return newUsageError("Incorrect usage: a key and a value are required", ctx)
+	}
+	key, value := ctx.Args()[0], ctx.Args()[1]
+	keys, err := configKeys(key)
+	if err != nil {
+		return err
+	}
+	v, err := configValue(keys, value)
+	if err != nil {
+		return fmt.Errorf("Error: %s: %v", key, err)
+	}
+
+	path := configFilePath(ctx)
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	if err := writeConfigDocument(path, setConfigKey(doc, keys, v)); err != nil {
+		return err
+	}
+	fmt.Printf("%s set in %s\n", key, path)
+	return nil
+}
+
+// configKeys splits a key of the config file, checking it is one of a setting,
+// an alias or a default.
+func configKeys(key string) ([]string, error) {
+	elems, err := parseConfigPath(key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(elems))
+	for _, e := range elems {
+		if e.isIdx {
+			return nil, fmt.Errorf("Error: bad key '%s': the config file has no arrays", key)
+		}
+		keys = append(keys, e.key)
+	}
+	if _, ok := configKeyTypes[strings.Join(keys, ".")]; ok {
+		return keys, nil
+	}
+	switch {
+	case keys[0] == "headers" && len(keys) == 2:
+		return keys, nil
+	case keys[0] == "aliases" && len(keys) == 2:
+		return keys, nil
+	case keys[0] == "defaults" && len(keys) == 3:
+		return keys, nil
+	}
+	return nil, fmt.Errorf("Error: unknown key '%s'", key)
+}
+
+// configValue converts the value of a setting to its type. The defaults of
+// the flags are YAML values, e.g. [file] for a list.
+func configValue(keys []string, value string) (interface{}, error) {
+	switch configKeyTypes[strings.Join(keys, ".")] {
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", value)
+		}
+		return b, nil
+	case "int":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("'%s' is not a positive integer", value)
+		}
+		return n, nil
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case "output":
+		if value != "text" && value != "json" {
+			return nil, fmt.Errorf("unsupported output format '%s' (expected text or json)", value)
+		}
+		return value, nil
+	case "string":
+		return value, nil
+	}
+	if keys[0] == "headers" {
+		return value, nil
+	}
+	if keys[0] == "aliases" {
+		if words, err := splitCommandLine(value); err != nil || len(words) == 0 {
+			return nil, fmt.Errorf("bad alias '%s'", value)
+		}
+		return value, nil
+	}
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// readConfigDocument reads a config file keeping the order of its keys; a
+// missing file is empty.
+func readConfigDocument(path string) (yaml.MapSlice, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		if me, ok := yamlSyntaxError(err).(*manifestError); ok {
+			me.file = path
+			return nil, fmt.Errorf("Invalid config: %v", me)
+		}
+		return nil, fmt.Errorf("Invalid config: %v", err)
+	}
+	if hasYAMLComments(b) {
+		fmt.Fprintf(os.Stderr, "Warning: the comments of %s are not preserved\n", path)
+	}
+	return doc, nil
+}
+
+// writeConfigDocument writes a config file, readable by its owner only as it
+// may hold a password, after checking it loads.
+func writeConfigDocument(path string, doc yaml.MapSlice) error {
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("Error: %v", err)
+	}
+	if err := yaml.Unmarshal(b, &config{}); err != nil {
+		return fmt.Errorf("Invalid config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating the directory of %s: %v", path, err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("Error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// setConfigKey sets the value at the keys of a document, adding the missing
+// keys after the existing ones.
+func setConfigKey(doc yaml.MapSlice, keys []string, v interface{}) yaml.MapSlice {
+	for i := range doc {
+		if fmt.Sprint(doc[i].Key) != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			doc[i].Value = v
+		} else {
+			sub, _ := doc[i].Value.(yaml.MapSlice)
+			doc[i].Value = setConfigKey(sub, keys[1:], v)
+		}
+		return doc
+	}
+	if len(keys) > 1 {
+		v = setConfigKey(nil, keys[1:], v)
+	}
+	return append(doc, yaml.MapItem{Key: keys[0], Value: v})
+}
+
+// migrateCLIConfig imports a config file of a former version, in JSON, into
+// the default config file: its rest.rest-auth-pwd becomes auth.password.
+func migrateCLIConfig(ctx *cli.Context) error {
+	src := ctx.Args().First()
+	if src == "" {
+		src = ctx.GlobalString("config")
+	}
+	if len(ctx.Args()) > 1 || src == "" {
+		return newUsageError("Incorrect usage: the config file to migrate is required", ctx)
+	}
+	dst := defaultConfigPath()
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return fmt.Errorf("Error: %s is already the default config file", src)
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("Error reading %s: %v", src, err)
+	}
+	old, err := readConfigDocument(src)
+	if err != nil {
+		return err
+	}
+	doc, err := readConfigDocument(dst)
+	if err != nil {
+		return err
+	}
+	for _, item := range old {
+		key := fmt.Sprint(item.Key)
+		if key != "rest" {
+			doc = setConfigKey(doc, []string{key}, item.Value)
+			continue
+		}
+		rest, _ := item.Value.(yaml.MapSlice)
+		for _, r := range rest {
+			if fmt.Sprint(r.Key) == "rest-auth-pwd" {
+				doc = setConfigKey(doc, []string{"auth", "password"}, fmt.Sprint(r.Value))
+			}
+		}
+	}
+	if err := writeConfigDocument(dst, doc); err != nil {
+		return err
+	}
+	fmt.Printf("%s migrated to %s\n", src, dst)
+	if ctx.GlobalString("config") != "" {
+		fmt.Println("It is read when neither --config nor $SNAPTEL_CONFIG_PATH is given")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// layouts of a complete date and time; the ones without an offset are
+	// interpreted in the time zone given with --tz
+	dateTimeLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+	}
+	// layouts of a date, "1-02-2006" being the historical snaptel format
+	dateLayouts = []string{
+		"1-02-2006",
+		"2006-01-02",
+	}
+	// layouts of a time of day, "3:04PM" being the historical snaptel format
+	clockLayouts = []string{
+		"3:04PM",
+		"3:04:05PM",
+		"3PM",
+		"15:04",
+		"15:04:05",
+	}
+)
+
+// mergeDateTime combines the values of a time flag (e.g. --start-time) and a
+// date flag (e.g. --start-date) into a point in time; it returns nil when both
+// are empty. Either flag can also hold a complete point in time:
+//
+//	2017-10-18T14:30:00+02:00   RFC 3339
+//	2017-10-18T14:30            ISO 8601, in the given location
+//	+15m                        relative to now
+//	now
+//	tomorrow 02:00              today or tomorrow at a time of day
+//	2017-10-18, tomorrow        a date alone, at midnight
+//
+// Otherwise the date is "1-02-2006", "2006-01-02", "today" or "tomorrow"
+// (today by default) and the time is "3:04PM", "15:04" or "15:04:05".
+// A date without a time means midnight.
+func mergeDateTime(tm, dt string, loc *time.Location) (*time.Time, error) {
+	tm = strings.TrimSpace(tm)
+	dt = strings.TrimSpace(dt)
+	if dt == "" && tm == "" {
+		return nil, nil
+	}
+	now := time.Now().In(loc)
+
+	for _, v := range []string{tm, dt} {
+		t, ok, err := parseDateTime(v, loc, now)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if tm != "" && dt != "" {
+			return nil, fmt.Errorf("'%v' is a complete date and time, it cannot be combined with '%v'", v, strings.TrimSpace(strings.Replace(tm+" "+dt, v, "", 1)))
+		}
+		return &t, nil
+	}
+
+	if dt == "" {
+		// a date given alone, e.g. to --start
+		if d, err := parseDate(tm, loc, now); err == nil {
+			return &d, nil
+		}
+	}
+
+	date := now.Add(createTaskNowPad)
+	if dt != "" {
+		d, err := parseDate(dt, loc, now)
+		if err != nil {
+			return nil, err
+		}
+		date = d
+		if tm == "" {
+			return &date, nil
+		}
+	}
+
+	h, m, s, err := parseClock(tm)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Date(date.Year(), date.Month(), date.Day(), h, m, s, 0, loc)
+	return &t, nil
+}
+
+// parseDateTime parses a complete point in time; ok is false when v is not
+// written as one.
+func parseDateTime(v string, loc *time.Location, now time.Time) (t time.Time, ok bool, err error) {
+	if v == "" {
+		return t, false, nil
+	}
+	if strings.ToLower(v) == "now" {
+		return now.Add(createTaskNowPad), true, nil
+	}
+	if strings.HasPrefix(v, "+") {
+		d, err := time.ParseDuration(v[1:])
+		if err != nil {
+			return t, false, fmt.Errorf("cannot parse relative time '%v': %v", v, err)
+		}
+		return now.Add(d), true, nil
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, true, nil
+		}
+	}
+	// a relative day followed by a time of day, e.g. "tomorrow 02:00"
+	if f := strings.Fields(v); len(f) == 2 {
+		if d, ok := relativeDay(f[0], now); ok {
+			h, m, s, err := parseClock(f[1])
+			if err != nil {
+				return t, false, err
+			}
+			return time.Date(d.Year(), d.Month(), d.Day(), h, m, s, 0, loc), true, nil
+		}
+	}
+	return t, false, nil
+}
+
+func parseDate(v string, loc *time.Location, now time.Time) (time.Time, error) {
+	if d, ok := relativeDay(v, now); ok {
+		return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse date '%v', expected a format like 10-18-2017, 2017-10-18, today or tomorrow", v)
+}
+
+// parseClock parses a time of day and returns its hour, minute and second.
+func parseClock(v string) (int, int, int, error) {
+	for _, layout := range clockLayouts {
+		if t, err := time.Parse(layout, strings.ToUpper(v)); err == nil {
+			return t.Hour(), t.Minute(), t.Second(), nil
+		}
+	}
+	return 0, 0, 0, fmt.Errorf("cannot parse time '%v', expected a format like 2:30PM, 14:30, 14:30:00, 2017-10-18T14:30:00Z, +15m or tomorrow 02:00", v)
+}
+
+func relativeDay(v string, now time.Time) (time.Time, bool) {
+	switch strings.ToLower(v) {
+	case "today":
+		return now, true
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,94 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeDateTime(t *testing.T) {
+	loc := time.FixedZone("CEST", 2*60*60)
+	at := func(y int, mo time.Month, d, h, m, s int) func(time.Time) time.Time {
+		return func(time.Time) time.Time { return time.Date(y, mo, d, h, m, s, 0, loc) }
+	}
+	day := func(days, h, m int) func(time.Time) time.Time {
+		return func(now time.Time) time.Time {
+			d := now.AddDate(0, 0, days)
+			return time.Date(d.Year(), d.Month(), d.Day(), h, m, 0, 0, loc)
+		}
+	}
+	in := func(d time.Duration) func(time.Time) time.Time {
+		return func(now time.Time) time.Time { return now.Add(d) }
+	}
+
+	tests := []struct {
+		tm, dt string
+		want   func(now time.Time) time.Time // nil for no time
+		err    bool
+	}{
+		{tm: "", dt: ""},
+		{tm: "2017-10-18T14:30:00Z", want: at(2017, 10, 18, 16, 30, 0)},
+		{tm: "2017-10-18T14:30:00+02:00", want: at(2017, 10, 18, 14, 30, 0)},
+		{tm: "2017-10-18T14:30", want: at(2017, 10, 18, 14, 30, 0)},
+		{tm: "2017-10-18 14:30:05", want: at(2017, 10, 18, 14, 30, 5)},
+		{tm: "+15m", want: in(15 * time.Minute)},
+		{tm: "now", want: in(createTaskNowPad)},
+		{tm: "tomorrow 02:00", want: day(1, 2, 0)},
+		{tm: "today 2:30PM", want: day(0, 14, 30)},
+		{tm: "2017-10-18", want: at(2017, 10, 18, 0, 0, 0)},
+		{tm: "10-18-2017", want: at(2017, 10, 18, 0, 0, 0)},
+		{tm: "tomorrow", want: day(1, 0, 0)},
+		{tm: "14:30", want: day(0, 14, 30)},
+		{tm: "2:30PM", dt: "10-18-2017", want: at(2017, 10, 18, 14, 30, 0)},
+		{tm: "14:30:05", dt: "2017-10-18", want: at(2017, 10, 18, 14, 30, 5)},
+		{tm: "3PM", dt: "tomorrow", want: day(1, 15, 0)},
+		{dt: "2017-10-18", want: at(2017, 10, 18, 0, 0, 0)},
+		{dt: "2017-10-18T14:30", want: at(2017, 10, 18, 14, 30, 0)},
+		{tm: "25:00", err: true},
+		{tm: "+15x", err: true},
+		{tm: "2:30PM", dt: "10/18/2017", err: true},
+		{tm: "2017-10-18T14:30", dt: "today", err: true},
+		{tm: "tomorrow 25:00", err: true},
+	}
+	for _, tt := range tests {
+		now := time.Now().In(loc)
+		got, err := mergeDateTime(tt.tm, tt.dt, loc)
+		switch {
+		case tt.err:
+			if err == nil {
+				t.Errorf("mergeDateTime(%q, %q) = %v, want an error", tt.tm, tt.dt, got)
+			}
+		case err != nil:
+			t.Errorf("mergeDateTime(%q, %q): %v", tt.tm, tt.dt, err)
+		case tt.want == nil:
+			if got != nil {
+				t.Errorf("mergeDateTime(%q, %q) = %v, want nil", tt.tm, tt.dt, got)
+			}
+		case got == nil:
+			t.Errorf("mergeDateTime(%q, %q) = nil, want %v", tt.tm, tt.dt, tt.want(now))
+		default:
+			// the relative times depend on the time of the call
+			if want := tt.want(now); got.Before(want) || got.Sub(want) > time.Second {
+				t.Errorf("mergeDateTime(%q, %q) = %v, want %v", tt.tm, tt.dt, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/urfave/cli"
+)
+
+// Exit codes of snaptel, by kind of error
+const (
+	ExitError        = 1 // any other error
+	ExitUsage        = 2 // bad command line, or request rejected as bad by snap
+	ExitNotFound     = 3
+	ExitConflict     = 4 // e.g. a plugin already loaded, a task already running
+	ExitUnauthorized = 5
+	ExitServer       = 6 // internal error of snap
+	ExitConnection   = 7 // snap not reached, or timed out
+	ExitTLSMismatch  = 8 // http/https mismatch, or certificate error
+)
+
+// errorKinds are the names of the kinds of errors, by exit code, given in the
+// JSON output.
+var errorKinds = map[int]string{
+	ExitError:        "error",
+	ExitUsage:        "usage",
+	ExitNotFound:     "not-found",
+	ExitConflict:     "conflict",
+	ExitUnauthorized: "unauthorized",
+	ExitServer:       "server",
+	ExitConnection:   "connection",
+	ExitTLSMismatch:  "tls-mismatch",
+}
+
+// outputFormat is the format of the output given with --output: text or json.
+var outputFormat = "text"
+
+// statusCodePattern matches the status code in the message of the error
+// responses of snap-client-go, e.g. "[GET /tasks/{id}][404] getTaskNotFound".
+var statusCodePattern = regexp.MustCompile(`\]\[(\d{3})\]`)
+
+// clientPackagePath is the path of the packages of snap-client-go holding the
+// error responses.
+const clientPackagePath = "snap-client-go/client"
+
+// APIError is an error of a request to snap: a response with an error status,
+// or no response at all.
+type APIError struct {
+	Code    int    // exit code
+	Status  int    // HTTP status of the response, 0 without one
+	Message string // without the "Error: " prefix
+	Hint    string // what to check, if any
+}
+
+// Error returns the message of the error, followed by its hint.
+func (e *APIError) Error() string {
+	if e.Hint != "" {
+		return "Error: " + e.Message + "\nHint: " + e.Hint
+	}
+	return "Error: " + e.Message
+}
+
+// getErrorDetail returns the error of a request to snap, with the message and
+// the status of its response for the error responses of every operation of
+// snap-client-go.
+func getErrorDetail(err error) error {
+	op, status, msg, ok := decodeErrorResponse(err, clientPackagePath)
+	if !ok {
+		return requestError(err)
+	}
+	e := newAPIError(status, msg)
+	e.Hint = errorHint(op, e.Code)
+	return e
+}
+
+// apiErrorMessage returns the message of the error of a request to snap,
+// without its hint, for the full-screen views.
+func apiErrorMessage(err error) string {
+	err = getErrorDetail(err)
+	if e, ok := err.(*APIError); ok {
+		return e.Message
+	}
+	return strings.TrimPrefix(err.Error(), "Error: ")
+}
+
+// decodeErrorResponse returns the operation, status and message of an error
+// response of snap-client-go: a struct of the packages whose path contains
+// pkgPath, named after the operation and the status, whose Payload holds an
+// ErrorMessage or a Message.
+func decodeErrorResponse(err error, pkgPath string) (op string, status int, msg string, ok bool) {
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return "", 0, "", false
+	}
+	t := v.Elem().Type()
+	payload := v.Elem().FieldByName("Payload")
+	if !strings.Contains(t.PkgPath(), pkgPath) || !payload.IsValid() {
+		return "", 0, "", false
+	}
+
+	op = t.Name()
+	if c, ok := err.(interface {
+		Code() int
+	}); ok {
+		// the default response of an operation
+		status, op = c.Code(), strings.TrimSuffix(op, "Default")
+	} else if m := statusCodePattern.FindStringSubmatch(err.Error()); m != nil {
+		status, _ = strconv.Atoi(m[1])
+	}
+	for code := 400; code < 600; code++ {
+		suffix := strings.Replace(http.StatusText(code), " ", "", -1)
+		if suffix != "" && strings.HasSuffix(op, suffix) && (status == 0 || status == code) {
+			status, op = code, strings.TrimSuffix(op, suffix)
+			break
+		}
+	}
+
+	for payload.Kind() == reflect.Ptr || payload.Kind() == reflect.Interface {
+		if payload.IsNil() {
+			break
+		}
+		payload = payload.Elem()
+	}
+	switch payload.Kind() {
+	case reflect.Struct:
+		for _, name := range []string{"ErrorMessage", "Message"} {
+			if f := payload.FieldByName(name); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+				msg = f.String()
+				break
+			}
+		}
+	case reflect.String:
+		msg = payload.String()
+	}
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	if msg == "" {
+		msg = err.Error()
+	}
+	return op, status, msg, true
+}
+
+// errorHint returns what to check for an error of an operation of snap, by the
+// exit code of the error.
+func errorHint(op string, code int) string {
+	task := strings.Contains(op, "Task")
+	plugin := strings.Contains(op, "Plugin")
+	switch code {
+	case ExitUnauthorized:
+		switch {
+		case authToken() != "":
+			return "is the token right?"
+		case hasPasswordAuth():
+			return "is the password right?"
+		}
+		return "did you forget --password or --token?"
+	case ExitNotFound:
+		switch {
+		case task:
+			return "see snaptel task list for the IDs of the tasks"
+		case strings.Contains(op, "Metric"):
+			return "is the plugin collecting the metric loaded? see snaptel metric list"
+		case plugin:
+			return "is the plugin loaded? see snaptel plugin list"
+		}
+	case ExitConflict:
+		switch {
+		case task:
+			return "see snaptel task list for the state of the task"
+		case plugin:
+			return "is the plugin already loaded, or used by a running task? see snaptel plugin list"
+		}
+	case ExitConnection:
+		return fmt.Sprintf("is snapteld running at %s? see --url and --timeout", FlURL.Value)
+	case ExitTLSMismatch:
+		return "does the scheme of --url (http or https) match snapteld's? --insecure skips the certificate check"
+	}
+	return ""
+}
+
+// newAPIError returns the error of a response of snap with an error status.
+func newAPIError(status int, msg string) *APIError {
+	code := ExitError
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		code = ExitUnauthorized
+	case status == http.StatusNotFound:
+		code = ExitNotFound
+	case status == http.StatusConflict:
+		code = ExitConflict
+	case status >= 500:
+		code = ExitServer
+	case status >= 400:
+		code = ExitUsage
+	}
+	return &APIError{Code: code, Status: status, Message: msg}
+}
+
+// requestError returns the error of a request which got no response of snap
+// with an error payload: a response not described by the API, or a failure to
+// connect.
+func requestError(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "tls: oversized record") || strings.Contains(msg, "malformed HTTP response") {
+		return &APIError{Code: ExitTLSMismatch, Message: strings.TrimPrefix(extractError(msg), "Error: "), Hint: errorHint("", ExitTLSMismatch)}
+	}
+	switch e := err.(type) {
+	case *runtime.APIError:
+		return newAPIError(e.Code, msg)
+	case *url.Error:
+		code := ExitConnection
+		if isCertificateError(e) {
+			code = ExitTLSMismatch
+		}
+		return &APIError{Code: code, Message: msg, Hint: errorHint("", code)}
+	}
+	return fmt.Errorf("Error: %v", err)
+}
+
+// isCertificateError tells whether a request failed on the certificate of the
+// daemon, or on a daemon not speaking TLS, the error being wrapped by the HTTP
+// client.
+func isCertificateError(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, tls.RecordHeaderError:
+			return true
+		default:
+			return isCertificateVerificationError(err)
+		}
+	}
+}
+
+// ExitStatus returns the exit code of snaptel for the error of a command.
+func ExitStatus(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return 0
+	case UsageError:
+		return ExitUsage
+	case *APIError:
+		return e.Code
+	case cli.ExitCoder:
+		return e.ExitCode()
+	}
+	return ExitError
+}
+
+// PrintError prints the error of a command in the format given with --output,
+// with the help of the command for a usage error in the text format.
+func PrintError(err error) {
+	if ec, ok := err.(cli.ExitCoder); ok && ec.Error() == "" {
+		// an extension which printed its own error
+		return
+	}
+	if outputFormat != "json" {
+		fmt.Println(err)
+		if ue, ok := err.(UsageError); ok {
+			ue.Help()
+		}
+		return
+	}
+
+	out := struct {
+		Error   string `json:"error"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  int    `json:"status,omitempty"`
+		Hint    string `json:"hint,omitempty"`
+	}{Code: ExitStatus(err), Message: strings.TrimPrefix(err.Error(), "Error: ")}
+	switch e := err.(type) {
+	case UsageError:
+		out.Message = e.s
+	case *APIError:
+		out.Message, out.Status, out.Hint = e.Message, e.Status, e.Hint
+	}
+	out.Error = errorKinds[out.Code]
+	if out.Error == "" {
+		out.Error = errorKinds[ExitError]
+	}
+	b, _ := json.Marshal(out)
+	fmt.Println(string(b))
+}
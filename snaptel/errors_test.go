@@ -0,0 +1,239 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	"github.com/intelsdi-x/snap-client-go/client/plugins"
+	"github.com/intelsdi-x/snap-client-go/client/tasks"
+	"github.com/intelsdi-x/snap-client-go/models"
+)
+
+// The error responses of snap-client-go which have no counterpart in the
+// client: the default response of an operation, named after the operation
+// only, and a response named after neither its status nor "default".
+
+type getTaskDefault struct {
+	_statusCode int
+	Payload     *models.Error
+}
+
+func (o *getTaskDefault) Code() int { return o._statusCode }
+
+func (o *getTaskDefault) Error() string {
+	return fmt.Sprintf("[GET /tasks/{id}][%d] getTask default  %+v", o._statusCode, o.Payload)
+}
+
+type watchTaskGone struct {
+	Payload string
+}
+
+func (o *watchTaskGone) Error() string {
+	return fmt.Sprintf("[GET /tasks/{id}/watch][404] watchTaskGone  %+v", o.Payload)
+}
+
+func TestDecodeErrorResponse(t *testing.T) {
+	// the package of the responses defined above
+	testPkgPath := reflect.TypeOf(getTaskDefault{}).PkgPath()
+	tests := []struct {
+		err     error
+		pkgPath string // clientPackagePath by default
+		op      string
+		status  int
+		msg     string
+		ok      bool
+	}{
+		{
+			err:    &tasks.GetTaskNotFound{Payload: &models.Error{ErrorMessage: "task not found"}},
+			op:     "GetTask",
+			status: 404,
+			msg:    "task not found",
+			ok:     true,
+		},
+		{
+			err:    &tasks.GetTaskUnauthorized{Payload: &models.UnauthError{Code: 401, Message: "Not authorized"}},
+			op:     "GetTask",
+			status: 401,
+			msg:    "Not authorized",
+			ok:     true,
+		},
+		{
+			err:    &tasks.UpdateTaskStateConflict{Payload: &models.Error{ErrorMessage: "task is already running"}},
+			op:     "UpdateTaskState",
+			status: 409,
+			msg:    "task is already running",
+			ok:     true,
+		},
+		{
+			err:    &plugins.GetMetricsNotFound{Payload: &models.Error{ErrorMessage: "metric not found"}},
+			op:     "GetMetrics",
+			status: 404,
+			msg:    "metric not found",
+			ok:     true,
+		},
+		{
+			// a nil payload
+			err:    &tasks.RemoveTaskNotFound{},
+			op:     "RemoveTask",
+			status: 404,
+			msg:    "Not Found",
+			ok:     true,
+		},
+		{
+			// an empty message
+			err:    &tasks.AddTaskInternalServerError{Payload: &models.Error{}},
+			op:     "AddTask",
+			status: 500,
+			msg:    "Internal Server Error",
+			ok:     true,
+		},
+		{
+			err:     &getTaskDefault{_statusCode: 503, Payload: &models.Error{ErrorMessage: "snapteld is stopping"}},
+			pkgPath: testPkgPath,
+			op:      "getTask",
+			status:  503,
+			msg:     "snapteld is stopping",
+			ok:      true,
+		},
+		{
+			err:     &getTaskDefault{_statusCode: 418},
+			pkgPath: testPkgPath,
+			op:      "getTask",
+			status:  418,
+			msg:     "I'm a teapot",
+			ok:      true,
+		},
+		{
+			// the status of the message, a string payload
+			err:     &watchTaskGone{Payload: "task was removed"},
+			pkgPath: testPkgPath,
+			op:      "watchTaskGone",
+			status:  404,
+			msg:     "task was removed",
+			ok:      true,
+		},
+		{
+			// not a response of the client
+			err: &getTaskDefault{_statusCode: 404},
+		},
+		{
+			err: fmt.Errorf("[GET /tasks][404] getTasksNotFound"),
+		},
+		{
+			err: (*tasks.GetTaskNotFound)(nil),
+		},
+	}
+	for _, tt := range tests {
+		pkgPath := clientPackagePath
+		if tt.pkgPath != "" {
+			pkgPath = tt.pkgPath
+		}
+		op, status, msg, ok := decodeErrorResponse(tt.err, pkgPath)
+		if op != tt.op || status != tt.status || msg != tt.msg || ok != tt.ok {
+			t.Errorf("decodeErrorResponse(%s) = %q, %d, %q, %v, want %q, %d, %q, %v",
+				reflect.TypeOf(tt.err), op, status, msg, ok, tt.op, tt.status, tt.msg, tt.ok)
+		}
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		status int
+		code   int
+	}{
+		{http.StatusBadRequest, ExitUsage},
+		{http.StatusUnauthorized, ExitUnauthorized},
+		{http.StatusForbidden, ExitUnauthorized},
+		{http.StatusNotFound, ExitNotFound},
+		{http.StatusConflict, ExitConflict},
+		{http.StatusUnsupportedMediaType, ExitUsage},
+		{http.StatusInternalServerError, ExitServer},
+		{http.StatusServiceUnavailable, ExitServer},
+		{http.StatusFound, ExitError},
+	}
+	for _, tt := range tests {
+		e := newAPIError(tt.status, "message")
+		if e.Code != tt.code || e.Status != tt.status || e.Message != "message" {
+			t.Errorf("newAPIError(%d) = %+v, want code %d", tt.status, e, tt.code)
+		}
+	}
+}
+
+func TestErrorHint(t *testing.T) {
+	defer func(w runtime.ClientAuthInfoWriter, url string) {
+		authInfoWriter, FlURL.Value = w, url
+	}(authInfoWriter, FlURL.Value)
+	FlURL.Value = "http://localhost:8181"
+
+	tests := []struct {
+		op   string
+		code int
+		auth *requestAuth
+		hint string
+	}{
+		{"GetTask", ExitUnauthorized, nil, "did you forget --password or --token?"},
+		{"GetTask", ExitUnauthorized, &requestAuth{token: "secret"}, "is the token right?"},
+		{"GetTask", ExitUnauthorized, &requestAuth{basic: &requestAuth{}}, "is the password right?"},
+		{"GetTask", ExitNotFound, nil, "see snaptel task list for the IDs of the tasks"},
+		{"GetMetrics", ExitNotFound, nil, "is the plugin collecting the metric loaded? see snaptel metric list"},
+		{"UnloadPlugin", ExitNotFound, nil, "is the plugin loaded? see snaptel plugin list"},
+		{"UpdateTaskState", ExitConflict, nil, "see snaptel task list for the state of the task"},
+		{"LoadPlugin", ExitConflict, nil, "is the plugin already loaded, or used by a running task? see snaptel plugin list"},
+		{"", ExitConnection, nil, "is snapteld running at http://localhost:8181? see --url and --timeout"},
+		{"", ExitTLSMismatch, nil, "does the scheme of --url (http or https) match snapteld's? --insecure skips the certificate check"},
+		{"AddTask", ExitServer, nil, ""},
+		{"AddTask", ExitUsage, nil, ""},
+		{"GetMember", ExitNotFound, nil, ""},
+	}
+	for _, tt := range tests {
+		authInfoWriter = nil
+		if tt.auth != nil {
+			authInfoWriter = tt.auth
+		}
+		if hint := errorHint(tt.op, tt.code); hint != tt.hint {
+			t.Errorf("errorHint(%q, %d) with %+v = %q, want %q", tt.op, tt.code, tt.auth, hint, tt.hint)
+		}
+	}
+}
+
+func TestRequestErrorCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	// the self-signed certificate of the server is not trusted
+	_, err := http.Get(srv.URL)
+	if err == nil {
+		t.Fatal("expected a certificate error")
+	}
+	if got := ExitStatus(requestError(err)); got != ExitTLSMismatch {
+		t.Errorf("ExitStatus(requestError(%v)) = %d, want %d", err, got, ExitTLSMismatch)
+	}
+
+	srv.Close()
+	_, err = http.Get(srv.URL)
+	if got := ExitStatus(requestError(err)); got != ExitConnection {
+		t.Errorf("ExitStatus(requestError(%v)) = %d, want %d", err, got, ExitConnection)
+	}
+}
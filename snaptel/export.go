@@ -0,0 +1,220 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+const (
+	promContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// promSample is the latest value received for one series.
+type promSample struct {
+	name   string
+	labels string
+	value  float64
+	seen   time.Time
+}
+
+// promStore keeps the latest sample of every series received from the
+// watched tasks and serves them in the Prometheus text format.
+type promStore struct {
+	sync.Mutex
+	samples    map[string]*promSample
+	staleAfter time.Duration
+}
+
+func newPromStore(staleAfter time.Duration) *promStore {
+	return &promStore{
+		samples:    map[string]*promSample{},
+		staleAfter: staleAfter,
+	}
+}
+
+func exportPrometheus(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return newUsageError("Incorrect usage: at least one task ID is required", ctx)
+	}
+	staleAfter := ctx.Duration("stale-after")
+	if staleAfter <= 0 {
+		return newUsageError("The --stale-after duration must be greater than zero", ctx)
+	}
+
+	store := newPromStore(staleAfter)
+	for _, id := range ctx.Args() {
+		go subscribeTaskWatch(id, store.update)
+	}
+
+	listen := ctx.String("listen")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", store)
+	fmt.Printf("Exporting metrics of task(s) %s on %s/metrics\n", strings.Join(ctx.Args(), ", "), listen)
+	return http.ListenAndServe(listen, mux)
+}
+
+func (s *promStore) update(taskID string, tskEvent *models.StreamedTaskEvent) {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	for _, e := range tskEvent.Event {
+		v, ok := toFloat(e.Data)
+		if !ok {
+			continue
+		}
+		name := promMetricName(e.Namespace)
+		labels := promLabels(taskID, e.Tags)
+		s.samples[name+labels] = &promSample{
+			name:   name,
+			labels: labels,
+			value:  v,
+			seen:   now,
+		}
+	}
+}
+
+// ServeHTTP writes the samples which are not stale yet, using the OpenMetrics
+// format when the scraper asks for it.
+func (s *promStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	var samples []*promSample
+	now := time.Now()
+	s.Lock()
+	for k, sm := range s.samples {
+		if now.Sub(sm.seen) > s.staleAfter {
+			delete(s.samples, k)
+			continue
+		}
+		samples = append(samples, sm)
+	}
+	s.Unlock()
+
+	sort.Sort(bySeries(samples))
+
+	typ := "untyped"
+	if openMetrics {
+		typ = "unknown"
+	}
+	var buf bytes.Buffer
+	for i, sm := range samples {
+		if i == 0 || samples[i-1].name != sm.name {
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", sm.name, typ)
+		}
+		fmt.Fprintf(&buf, "%s%s %s\n", sm.name, sm.labels, strconv.FormatFloat(sm.value, 'g', -1, 64))
+	}
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", promContentType)
+	}
+	w.Write(buf.Bytes())
+}
+
+// bySeries sorts samples by metric name and label set.
+type bySeries []*promSample
+
+func (s bySeries) Len() int {
+	return len(s)
+}
+func (s bySeries) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s bySeries) Less(i, j int) bool {
+	if s[i].name != s[j].name {
+		return s[i].name < s[j].name
+	}
+	return s[i].labels < s[j].labels
+}
+
+// promMetricName converts a snap namespace into a Prometheus metric name,
+// e.g. /intel/procfs/load/min1 becomes intel_procfs_load_min1.
+func promMetricName(ns string) string {
+	sep := GetFirstChar(ns)
+	parts := strings.Split(strings.TrimPrefix(ns, sep), sep)
+	name := promSanitize(strings.Join(parts, "_"), true)
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// promLabels returns the label set of a series, built from the task ID and
+// the metric tags, in the `{name="value",...}` form.
+func promLabels(taskID string, tags map[string]string) string {
+	labels := map[string]string{}
+	for k, v := range tags {
+		name := promSanitize(k, false)
+		if name == "" || strings.HasPrefix(name, "__") {
+			continue
+		}
+		labels[name] = v
+	}
+	labels["task_id"] = taskID
+
+	var keys []string
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"=\""+promEscape(labels[k])+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promSanitize replaces the characters which are not allowed in metric
+// (colons allowed) or label names with underscores.
+func promSanitize(s string, colons bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		case c == ':' && colons:
+		default:
+			b[i] = '_'
+		}
+	}
+	// names cannot start with a digit
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,216 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// extensionPrefix is the prefix of the executables run as snaptel commands:
+// snaptel-<name> on the PATH is run by `snaptel <name>`.
+const extensionPrefix = "snaptel-"
+
+// ListsExtensions tells whether the command line given by args, the arguments
+// of snaptel, lists the commands: help, and the completion of the command line
+// and of the shell. Only then is the PATH scanned for the extensions, which are
+// else looked up when no command matches by RunExtension.
+func ListsExtensions(flags []cli.Flag, args []string) bool {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--help" || args[i] == "-h" {
+			return true
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			switch args[i] {
+			case "help", "h", "shell", "__complete":
+				return true
+			}
+			return false
+		}
+		if f := findFlag(flags, args[i]); f != nil && flagTakesValue(f) && !strings.Contains(args[i], "=") {
+			i++
+		}
+	}
+	// snaptel alone shows the help
+	return true
+}
+
+// RunExtension is the action of snaptel when no command matches: it runs the
+// snaptel-<name> executable found on the PATH, if any, like the commands of
+// ExtensionCommands, or else shows the help.
+func RunExtension(ctx *cli.Context) error {
+	name := ctx.Args().First()
+	if name == "" {
+		return cli.ShowAppHelp(ctx)
+	}
+	path, err := exec.LookPath(extensionPrefix + name)
+	if err != nil || strings.ContainsAny(name, `/\`) {
+		return cli.ShowCommandHelp(ctx, name)
+	}
+	return execExtension(ctx, path, ctx.Args().Tail())
+}
+
+// ExtensionCommands returns a command for every snaptel-<name> executable
+// found on the PATH whose name is not the one of a command of cmds. The first
+// one found on the PATH wins, like for the shell.
+func ExtensionCommands(cmds []cli.Command) []cli.Command {
+	found := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			name, ok := extensionName(fi)
+			if !ok || found[name] != "" || findCommand(cmds, name) != nil {
+				continue
+			}
+			found[name] = filepath.Join(dir, fi.Name())
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]cli.Command, 0, len(names))
+	for _, name := range names {
+		out = append(out, cli.Command{
+			Name:     name,
+			Usage:    "Extension " + found[name],
+			Category: "extensions",
+			// flags, including --help, are the extension's own
+			SkipFlagParsing: true,
+			HideHelp:        true,
+			Action:          runExtension(found[name]),
+		})
+	}
+	return out
+}
+
+// extensionName returns the command name of an executable file named
+// snaptel-<name>.
+func extensionName(fi os.FileInfo) (string, bool) {
+	name := fi.Name()
+	if !strings.HasPrefix(name, extensionPrefix) || fi.IsDir() {
+		return "", false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else if fi.Mode()&0111 == 0 {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, extensionPrefix)
+	return name, name != ""
+}
+
+// runExtension runs an extension with the arguments of its command. The
+// settings of snaptel are passed in the environment:
+//
+//	SNAP_URL             URL of the snap daemon
+//	SNAP_API_VERSION     API version
+//	SNAP_INSECURE        "true" when certificate errors are ignored
+//	SNAPTEL_TIMEOUT      timeout of the requests, e.g. 10s
+//	SNAPTEL_PASSWORD     password of the REST API, when authentication is on
+//	SNAPTEL_TOKEN        bearer token of the REST API, when given instead
+//	SNAPTEL_HEADERS      headers of the requests, one "Name: value" per line
+//	SNAPTEL_CA_CERT      CA certificate verifying the daemon, if any
+//	SNAPTEL_CERT         client certificate, if any
+//	SNAPTEL_KEY          key of the client certificate, if any
+//	SNAPTEL_PROXY        proxy given with --proxy, also set as HTTP(S)_PROXY
+//	SNAPTEL              path of the snaptel executable
+//
+// The extension exits snaptel with its own exit status.
+func runExtension(path string) func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		return execExtension(ctx, path, ctx.Args())
+	}
+}
+
+func execExtension(ctx *cli.Context, path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SNAP_URL="+FlURL.Value,
+		"SNAP_API_VERSION="+FlAPIVer.Value,
+		"SNAP_INSECURE="+strconv.FormatBool(ctx.GlobalBool("insecure")),
+		"SNAPTEL_TIMEOUT="+ctx.GlobalDuration("timeout").String(),
+	)
+	if hasPasswordAuth() {
+		cmd.Env = append(cmd.Env, "SNAPTEL_PASSWORD="+password)
+	}
+	if token := authToken(); token != "" {
+		cmd.Env = append(cmd.Env, "SNAPTEL_TOKEN="+token)
+	}
+	if h := authHeaders(); len(h) > 0 {
+		var lines []string
+		for name, values := range h {
+			for _, v := range values {
+				lines = append(lines, name+": "+v)
+			}
+		}
+		sort.Strings(lines)
+		cmd.Env = append(cmd.Env, "SNAPTEL_HEADERS="+strings.Join(lines, "\n"))
+	}
+	if caCert, cert, key, err := TLSFiles(ctx); err == nil {
+		for _, f := range []struct{ name, path string }{{"SNAPTEL_CA_CERT", caCert}, {"SNAPTEL_CERT", cert}, {"SNAPTEL_KEY", key}} {
+			if f.path != "" {
+				cmd.Env = append(cmd.Env, f.name+"="+f.path)
+			}
+		}
+	}
+	if proxy := ctx.GlobalString("proxy"); proxy != "" {
+		cmd.Env = append(cmd.Env, "SNAPTEL_PROXY="+proxy, "HTTP_PROXY="+proxy, "HTTPS_PROXY="+proxy)
+	}
+	if self, err := executable(); err == nil {
+		cmd.Env = append(cmd.Env, "SNAPTEL="+self)
+	}
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(interface {
+			ExitStatus() int
+		}); ok {
+			return cli.NewExitError("", status.ExitStatus())
+		}
+		return cli.NewExitError("", 1)
+	}
+	if err != nil {
+		return fmt.Errorf("Error running %s: %v", path, err)
+	}
+	return nil
+}
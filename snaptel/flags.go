@@ -25,7 +25,7 @@ import (
 	"github.com/urfave/cli"
 )
 
-// FlURL to FlTimeout are Main flags
+// FlURL to FlProxy are Main flags
 var (
 	FlURL = cli.StringFlag{
 		Name:   "url, u",
@@ -56,7 +56,7 @@ var (
 	FlConfig = cli.StringFlag{
 		Name:   "config, c",
 		EnvVar: "SNAPTEL_CONFIG_PATH,SNAPCTL_CONFIG_PATH",
-		Usage:  "Path to a config file",
+		Usage:  "Path to a config file [defaults to ~/.config/snaptel/config.yaml]",
 		Value:  "",
 	}
 	FlTimeout = cli.DurationFlag{
@@ -64,6 +64,55 @@ var (
 		Usage: "Timeout to be set on HTTP request to the server",
 		Value: 10 * time.Second,
 	}
+	FlOutput = cli.StringFlag{
+		Name:   "output, o",
+		Usage:  "Format of the errors: text or json",
+		EnvVar: "SNAPTEL_OUTPUT",
+		Value:  "text",
+	}
+	FlDebugHTTP = cli.BoolFlag{
+		Name:   "debug-http",
+		Usage:  "Log the HTTP requests and responses on stderr, credentials redacted",
+		EnvVar: "SNAPTEL_DEBUG_HTTP",
+	}
+	FlTiming = cli.BoolFlag{
+		Name:   "timing",
+		Usage:  "Log the DNS, connect, TLS, first byte and total latencies of the HTTP requests on stderr",
+		EnvVar: "SNAPTEL_TIMING",
+	}
+	FlRetries = cli.IntFlag{
+		Name:   "retries",
+		Usage:  "Number of retries of the idempotent requests failing to connect or with a server error",
+		EnvVar: "SNAPTEL_RETRIES",
+	}
+	FlRetryBackoff = cli.DurationFlag{
+		Name:   "retry-backoff",
+		Usage:  "Delay before the first retry, doubled for each next one and jittered",
+		EnvVar: "SNAPTEL_RETRY_BACKOFF",
+		Value:  500 * time.Millisecond,
+	}
+	FlRetryAll = cli.BoolFlag{
+		Name:  "retry-all",
+		Usage: "Retry the requests which are not idempotent too, e.g. creating a task or loading a plugin",
+	}
+	FlHeader = cli.StringSliceFlag{
+		Name:  "header, H",
+		Usage: "Header of the requests to snap, as 'Name: value', e.g. for an API gateway; can be repeated",
+	}
+	FlToken = cli.StringFlag{
+		Name:   "token",
+		Usage:  "Bearer token of the requests to snap, sent instead of the password",
+		EnvVar: "SNAPTEL_TOKEN",
+	}
+	FlTokenFile = cli.StringFlag{
+		Name:   "token-file",
+		Usage:  "File holding the bearer token of the requests to snap",
+		EnvVar: "SNAPTEL_TOKEN_FILE",
+	}
+	FlProxy = cli.StringFlag{
+		Name:  "proxy",
+		Usage: "URL of the proxy of the requests to snap, instead of $HTTP_PROXY, $HTTPS_PROXY and $NO_PROXY",
+	}
 
 	// Plugin flags
 	flPluginAsc = cli.StringFlag{
@@ -103,11 +152,11 @@ var (
 	}
 	flTaskManifest = cli.StringFlag{
 		Name:  "task-manifest, t",
-		Usage: "File path for task manifest to use for task creation.",
+		Usage: "File path, URL or - (stdin) for task manifest to use for task creation.",
 	}
 	flWorkfowManifest = cli.StringFlag{
 		Name:  "workflow-manifest, w",
-		Usage: "File path for workflow manifest to use for task creation",
+		Usage: "File path, URL or - (stdin) for workflow manifest to use for task creation",
 	}
 	flTaskSchedInterval = cli.StringFlag{
 		Name:  "interval, i",
@@ -115,19 +164,31 @@ var (
 	}
 	flTaskSchedStartTime = cli.StringFlag{
 		Name:  "start-time",
-		Usage: "Start time for the task schedule [defaults to now]",
+		Usage: "Start time for the task schedule [ex: 2:30PM, 14:30; defaults to now]",
 	}
 	flTaskSchedStopTime = cli.StringFlag{
 		Name:  "stop-time",
-		Usage: "Start time for the task schedule [defaults to now]",
+		Usage: "Stop time for the task schedule [ex: 2:30PM, 14:30; defaults to now]",
+	}
+	flTaskSchedStart = cli.StringFlag{
+		Name:  "start",
+		Usage: "Start of the task schedule [ex: 2017-10-18T14:30:00Z, 2017-10-18 14:30, +15m, now, tomorrow 02:00]",
+	}
+	flTaskSchedStop = cli.StringFlag{
+		Name:  "stop",
+		Usage: "Stop of the task schedule [ex: 2017-10-18T18:00:00+02:00, +2h, today 23:59]",
+	}
+	flTaskSchedTimeZone = cli.StringFlag{
+		Name:  "tz",
+		Usage: "Time zone of the schedule times which have no UTC offset, e.g. UTC or Europe/Warsaw [defaults to the local time zone]",
 	}
 	flTaskSchedStartDate = cli.StringFlag{
 		Name:  "start-date",
-		Usage: "Start date for the task schedule [defaults to today]",
+		Usage: "Start date for the task schedule [ex: 10-18-2017, 2017-10-18, tomorrow; defaults to today]",
 	}
 	flTaskSchedStopDate = cli.StringFlag{
 		Name:  "stop-date",
-		Usage: "Stop date for the task schedule [defaults to today]",
+		Usage: "Stop date for the task schedule [ex: 10-18-2017, 2017-10-18, tomorrow; defaults to today]",
 	}
 	flTaskSchedCount = cli.StringFlag{
 		Name:  "count",
@@ -137,6 +198,26 @@ var (
 		Name:  "duration, d",
 		Usage: "The amount of time to run the task [appends to start or creates a start time before a stop]",
 	}
+	flTaskSchedStreaming = cli.BoolFlag{
+		Name:  "streaming",
+		Usage: "Use a streaming schedule, which collects the metrics as the plugins stream them [no interval]",
+	}
+	flTaskMaxCollectDuration = cli.StringFlag{
+		Name:  "max-collect-duration",
+		Usage: "The longest time the metrics of a streaming task are buffered before they are processed and published [ex: 10s]",
+	}
+	flTaskMaxMetricsBuffer = cli.StringFlag{
+		Name:  "max-metrics-buffer",
+		Usage: "The number of metrics of a streaming task buffered before they are processed and published [defaults to 0, no buffering]",
+	}
+	flTaskManifestFormat = cli.StringFlag{
+		Name:  "format",
+		Usage: "Format of the manifest, json or yaml [detected from the file extension, the content type or the content]",
+	}
+	flTaskCreateRollback = cli.BoolFlag{
+		Name:  "rollback",
+		Usage: "Remove the tasks already created from a multi-document manifest when the creation of a later one fails",
+	}
 	flTaskSchedNoStart = cli.BoolFlag{
 		Name:  "no-start",
 		Usage: "Do not start task on creation [normally started on creation]",
@@ -150,6 +231,81 @@ var (
 		Usage: "The number of consecutive failures before Snap disables the task",
 	}
 
+	flSchedulePreviewTask = cli.StringFlag{
+		Name:  "task, t",
+		Usage: "Task manifest (file path, URL or - for stdin) or ID of an existing task whose schedule is previewed",
+	}
+	flSchedulePreviewNumber = cli.IntFlag{
+		Name:  "number, n",
+		Usage: "The number of upcoming runs to print",
+		Value: 10,
+	}
+
+	flTaskInitMetric = cli.StringSliceFlag{
+		Name:  "metric, m",
+		Usage: "Glob of the namespaces of the metrics to collect, can be repeated [ex: '/intel/procfs/load/*'; asked for when omitted]",
+	}
+	flTaskInitProcessor = cli.StringSliceFlag{
+		Name:  "processor",
+		Usage: "Processor applied to the metrics, as <name>[:<version>], can be repeated to chain processors",
+	}
+	flTaskInitPublisher = cli.StringSliceFlag{
+		Name:  "publisher",
+		Usage: "Publisher of the metrics, as <name>[:<version>], can be repeated",
+	}
+	flTaskInitInterval = cli.StringFlag{
+		Name:  "interval, i",
+		Usage: "Interval of the task schedule",
+		Value: "1s",
+	}
+	flTaskInitForce = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Overwrite the output file if it exists",
+	}
+
+	flTaskGraphManifest = cli.StringFlag{
+		Name:  "task-manifest, t",
+		Usage: "Task or workflow manifest to render instead of an existing task",
+	}
+	flTaskGraphFormat = cli.StringFlag{
+		Name:  "format, f",
+		Usage: "Output format of the graph: ascii, dot or mermaid",
+		Value: "ascii",
+	}
+
+	flTaskCloneSetConfig = cli.StringSliceFlag{
+		Name:  "set-config",
+		Usage: "Set a value of the workflow, as <path>=<value>, can be repeated [ex: 'collect.process[0].publish[0].config.file=/tmp/debug.log']",
+	}
+
+	flTaskListWatch = cli.BoolFlag{
+		Name:  "watch",
+		Usage: "Refresh the task list in place, showing the changes of the counters",
+	}
+	flTaskListInterval = cli.DurationFlag{
+		Name:  "interval, i",
+		Usage: "Refresh interval of the task list when watching",
+		Value: 2 * time.Second,
+	}
+
+	// manifest
+	flManifestTo = cli.StringFlag{
+		Name:  "to",
+		Usage: "Output format of the manifest, json or yaml [defaults to the other format than the input]",
+	}
+	flManifestWrapWorkflow = cli.BoolFlag{
+		Name:  "wrap-workflow",
+		Usage: "Wrap a workflow manifest into a task manifest, using the schedule given with the schedule flags",
+	}
+	flManifestForce = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Format YAML manifests even though their comments are removed",
+	}
+	flManifestWorkflow = cli.BoolFlag{
+		Name:  "workflow",
+		Usage: "Validate workflow manifests instead of task manifests",
+	}
+
 	// metric
 	flMetricVersion = cli.IntFlag{
 		Name:  "metric-version, v",
@@ -160,6 +316,53 @@ var (
 		Usage: "A metric namespace",
 	}
 
+	// watch
+	flWatchAlert = cli.StringSliceFlag{
+		Name:  "alert",
+		Usage: "Alert rule evaluated against watched metrics, can be repeated [ex: 'ns=/intel/procfs/load/* value>4 for 30s']",
+	}
+	flWatchExec = cli.StringFlag{
+		Name:  "exec",
+		Usage: "Command run on alert transitions, receives the event as JSON on stdin and SNAPTEL_* environment variables",
+	}
+
+	// export
+	flExportListen = cli.StringFlag{
+		Name:  "listen, l",
+		Usage: "Address to serve the /metrics endpoint on",
+		Value: ":9100",
+	}
+	flExportStaleAfter = cli.DurationFlag{
+		Name:  "stale-after",
+		Usage: "Stop exporting series which have not been received for this long",
+		Value: 5 * time.Minute,
+	}
+
+	// forward
+	flForwardTo = cli.StringFlag{
+		Name:  "to",
+		Usage: "Endpoint to forward metrics to [ex: influx://host:8086/db, graphite://host:2003, statsd://host:8125]",
+	}
+	flForwardMap = cli.StringSliceFlag{
+		Name:  "map",
+		Usage: "Rule renaming the namespaces matching a regexp, can be repeated [ex: '^/intel/procfs/load/(.*)$=load.$1']",
+	}
+	flForwardBatchSize = cli.IntFlag{
+		Name:  "batch-size",
+		Usage: "Maximum number of metrics written at once",
+		Value: 100,
+	}
+	flForwardBufferSize = cli.IntFlag{
+		Name:  "buffer-size",
+		Usage: "Maximum number of metrics kept for retry while the endpoint is unavailable",
+		Value: 10000,
+	}
+	flForwardFlushInterval = cli.DurationFlag{
+		Name:  "flush-interval",
+		Usage: "Interval for writing incomplete batches",
+		Value: time.Second,
+	}
+
 	// general
 	flVerbose = cli.BoolFlag{
 		Name:  "verbose",
@@ -0,0 +1,486 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+// maximum size of a single StatsD datagram
+const statsdMaxPacket = 1432
+
+// forwardPoint is a metric received from a watch stream, ready to be written to a sink.
+type forwardPoint struct {
+	name  string
+	tags  map[string]string
+	data  interface{}
+	value float64
+	// numeric is false when data cannot be converted to a float value
+	numeric   bool
+	timestamp time.Time
+}
+
+// forwardSink writes batches of points to a remote endpoint in its wire format.
+// write returns the number of leading points of the batch which were written,
+// all of them unless it fails, so that only the others are sent again.
+type forwardSink interface {
+	write(points []forwardPoint) (int, error)
+	close()
+}
+
+// forwardRejectedError is returned by a sink when the endpoint refused a batch;
+// such a batch is dropped instead of being kept for a retry.
+type forwardRejectedError struct {
+	msg string
+}
+
+func (e forwardRejectedError) Error() string {
+	return e.msg
+}
+
+// forwardAuthError is returned by a sink when the endpoint refused the
+// credentials; forwarding stops, as every other batch would be refused too.
+type forwardAuthError struct {
+	msg string
+}
+
+func (e forwardAuthError) Error() string {
+	return e.msg
+}
+
+// flushResult is the outcome of a flush: the points to retry and the error
+// stopping the forwarding, if any.
+type flushResult struct {
+	left []forwardPoint
+	err  error
+}
+
+// nameMapping renames the namespaces matching a pattern.
+type nameMapping struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+func parseNameMappings(rules []string) ([]nameMapping, error) {
+	var mappings []nameMapping
+	for _, r := range rules {
+		i := strings.LastIndex(r, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("Invalid mapping rule '%v', expected <regexp>=<replacement>", r)
+		}
+		re, err := regexp.Compile(r[:i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid mapping rule '%v': %v", r, err)
+		}
+		mappings = append(mappings, nameMapping{re: re, repl: r[i+1:]})
+	}
+	return mappings, nil
+}
+
+// forwardMetricName applies the first matching mapping rule to the namespace;
+// namespaces without a matching rule have their elements joined by dots,
+// e.g. /intel/procfs/load/min1 becomes intel.procfs.load.min1.
+func forwardMetricName(ns string, mappings []nameMapping) string {
+	for _, m := range mappings {
+		if m.re.MatchString(ns) {
+			return m.re.ReplaceAllString(ns, m.repl)
+		}
+	}
+	sep := GetFirstChar(ns)
+	parts := strings.Split(strings.TrimPrefix(ns, sep), sep)
+	for i, p := range parts {
+		parts[i] = strings.NewReplacer(".", "_", " ", "_").Replace(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+func forwardTask(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return newUsageError("Incorrect usage: at least one task ID is required", ctx)
+	}
+	if !ctx.IsSet("to") {
+		return newUsageError("Must provide the --to endpoint", ctx)
+	}
+	batchSize := ctx.Int("batch-size")
+	bufferSize := ctx.Int("buffer-size")
+	flushInterval := ctx.Duration("flush-interval")
+	if batchSize < 1 || bufferSize < batchSize || flushInterval <= 0 {
+		return newUsageError("The batch size and flush interval must be greater than zero and the buffer size cannot be smaller than the batch size", ctx)
+	}
+	mappings, err := parseNameMappings(ctx.StringSlice("map"))
+	if err != nil {
+		return newUsageError(err.Error(), ctx)
+	}
+	sink, err := newForwardSink(ctx.String("to"))
+	if err != nil {
+		return newUsageError(err.Error(), ctx)
+	}
+	defer sink.close()
+
+	points := make(chan []forwardPoint, 64)
+	for _, id := range ctx.Args() {
+		go subscribeTaskWatch(id, func(id string, tskEvent *models.StreamedTaskEvent) {
+			points <- toForwardPoints(id, tskEvent, mappings)
+		})
+	}
+
+	// Flush what is buffered before exiting on interrupt
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, syscall.SIGTERM)
+	defer signal.Stop(c)
+
+	// The sink is written by another goroutine, so that a slow or unreachable
+	// endpoint does not hold up the watch streams. The points received during
+	// a flush are buffered until the next one.
+	flushes := make(chan []forwardPoint)
+	results := make(chan flushResult)
+	go func() {
+		for batch := range flushes {
+			left, err := flushForwardPoints(sink, batch, batchSize)
+			results <- flushResult{left, err}
+		}
+	}()
+	defer close(flushes)
+
+	fmt.Printf("Forwarding task(s) %s to %s\n", strings.Join(ctx.Args(), ", "), ctx.String("to"))
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var pending []forwardPoint
+	flushing := false
+	flush := func() {
+		if !flushing && len(pending) > 0 {
+			flushes <- pending
+			pending, flushing = nil, true
+		}
+	}
+	for {
+		select {
+		case ps := <-points:
+			pending = trimForwardBuffer(append(pending, ps...), bufferSize)
+			if len(pending) >= batchSize {
+				flush()
+			}
+		case r := <-results:
+			flushing = false
+			if r.err != nil {
+				return r.err
+			}
+			pending = trimForwardBuffer(append(r.left, pending...), bufferSize)
+		case <-ticker.C:
+			flush()
+		case <-c:
+			if flushing {
+				r := <-results
+				if r.err != nil {
+					return r.err
+				}
+				pending = append(r.left, pending...)
+			}
+			left, err := flushForwardPoints(sink, pending, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(left) > 0 {
+				fmt.Fprintf(os.Stderr, "Stopping forward, %d point(s) were not sent\n", len(left))
+			}
+			return nil
+		}
+	}
+}
+
+// trimForwardBuffer drops the oldest points beyond the size of the buffer.
+func trimForwardBuffer(pending []forwardPoint, bufferSize int) []forwardPoint {
+	if over := len(pending) - bufferSize; over > 0 {
+		fmt.Fprintf(os.Stderr, "Forward buffer full, dropping %d point(s)\n", over)
+		return pending[over:]
+	}
+	return pending
+}
+
+// flushForwardPoints writes the pending points in batches and returns the
+// points which have to be retried, or the error stopping the forwarding when
+// the endpoint refuses the credentials.
+func flushForwardPoints(sink forwardSink, pending []forwardPoint, batchSize int) ([]forwardPoint, error) {
+	for len(pending) > 0 {
+		batch := pending[:min(batchSize, len(pending))]
+		n, err := sink.write(batch)
+		switch err.(type) {
+		case nil:
+			n = len(batch)
+		case forwardAuthError:
+			return pending, &APIError{Code: ExitUnauthorized, Message: err.Error(), Hint: "check the user and password of the --to endpoint"}
+		case forwardRejectedError:
+			fmt.Fprintf(os.Stderr, "Dropping %d point(s): %v\n", len(batch)-n, err)
+			n = len(batch)
+		default:
+			fmt.Fprintf(os.Stderr, "Error forwarding metrics, %d point(s) will be retried: %v\n", len(pending)-n, err)
+			return pending[n:], nil
+		}
+		pending = pending[n:]
+	}
+	return nil, nil
+}
+
+func toForwardPoints(taskID string, tskEvent *models.StreamedTaskEvent, mappings []nameMapping) []forwardPoint {
+	points := make([]forwardPoint, 0, len(tskEvent.Event))
+	for _, e := range tskEvent.Event {
+		tags := map[string]string{"task_id": taskID}
+		for k, v := range e.Tags {
+			tags[k] = v
+		}
+		v, ok := toFloat(e.Data)
+		ts := time.Time(e.Timestamp)
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		points = append(points, forwardPoint{
+			name:      forwardMetricName(e.Namespace, mappings),
+			tags:      tags,
+			data:      e.Data,
+			value:     v,
+			numeric:   ok,
+			timestamp: ts,
+		})
+	}
+	return points
+}
+
+// newForwardSink creates the sink for one of the following endpoints:
+//
+//	influx://[user:password@]host:8086/db (influxs:// for HTTPS)
+//	graphite://host:2003
+//	statsd://host:8125
+func newForwardSink(endpoint string) (forwardSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid endpoint '%v': %v", endpoint, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Invalid endpoint '%v': missing host", endpoint)
+	}
+	switch u.Scheme {
+	case "influx", "influxs":
+		db := strings.Trim(u.Path, "/")
+		if db == "" {
+			return nil, fmt.Errorf("Invalid endpoint '%v': missing database name", endpoint)
+		}
+		scheme := "http"
+		if u.Scheme == "influxs" {
+			scheme = "https"
+		}
+		q := url.Values{}
+		q.Set("db", db)
+		q.Set("precision", "ns")
+		if u.User != nil {
+			q.Set("u", u.User.Username())
+			p, _ := u.User.Password()
+			q.Set("p", p)
+		}
+		return &influxSink{
+			url:    fmt.Sprintf("%s://%s/write?%s", scheme, u.Host, q.Encode()),
+			client: &http.Client{Timeout: FlTimeout.Value},
+		}, nil
+	case "graphite":
+		return &graphiteSink{addr: u.Host}, nil
+	case "statsd":
+		return &statsdSink{addr: u.Host}, nil
+	}
+	return nil, fmt.Errorf("Unsupported endpoint '%v', use one of influx://, graphite:// or statsd://", endpoint)
+}
+
+// influxSink writes points using the InfluxDB line protocol over HTTP.
+type influxSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *influxSink) write(points []forwardPoint) (int, error) {
+	var buf bytes.Buffer
+	for _, p := range points {
+		buf.WriteString(influxLine(p))
+	}
+	if buf.Len() == 0 {
+		return len(points), nil
+	}
+	resp, err := s.client.Post(s.url, "text/plain; charset=utf-8", &buf)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return len(points), nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	msg := fmt.Sprintf("InfluxDB responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return 0, forwardAuthError{msg}
+	case resp.StatusCode/100 == 4:
+		return 0, forwardRejectedError{msg}
+	}
+	return 0, fmt.Errorf(msg)
+}
+
+func (s *influxSink) close() {}
+
+// influxLine formats a point as `measurement,tag=value value=1.5 <ns timestamp>`.
+func influxLine(p forwardPoint) string {
+	var field string
+	if p.numeric {
+		field = strconv.FormatFloat(p.value, 'g', -1, 64)
+	} else {
+		field = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fmt.Sprintf("%v", p.data)) + `"`
+	}
+	escape := strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	line := strings.NewReplacer(",", `\,`, " ", `\ `).Replace(p.name)
+	for _, t := range sortTags(p.tags) {
+		kv := strings.SplitN(t, "=", 2)
+		if kv[1] == "" {
+			continue
+		}
+		line += "," + escape.Replace(kv[0]) + "=" + escape.Replace(kv[1])
+	}
+	return fmt.Sprintf("%s value=%s %d\n", line, field, p.timestamp.UnixNano())
+}
+
+// graphiteSink writes points using the Graphite plaintext protocol over TCP.
+type graphiteSink struct {
+	addr string
+	conn net.Conn
+}
+
+func (s *graphiteSink) write(points []forwardPoint) (int, error) {
+	var buf bytes.Buffer
+	// the offset of the end of the line of each point
+	ends := make([]int, len(points))
+	for i, p := range points {
+		if p.numeric {
+			buf.WriteString(graphiteLine(p))
+		}
+		ends[i] = buf.Len()
+	}
+	if buf.Len() == 0 {
+		return len(points), nil
+	}
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, FlTimeout.Value)
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(FlTimeout.Value))
+	if written, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.close()
+		// the points whose lines were written in full are not sent again
+		n := 0
+		for n < len(ends) && ends[n] <= written {
+			n++
+		}
+		return n, err
+	}
+	return len(points), nil
+}
+
+func (s *graphiteSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// graphiteLine formats a point as `name value <unix timestamp>`.
+func graphiteLine(p forwardPoint) string {
+	name := strings.Replace(p.name, " ", "_", -1)
+	return fmt.Sprintf("%s %s %d\n", name, strconv.FormatFloat(p.value, 'g', -1, 64), p.timestamp.Unix())
+}
+
+// statsdSink writes points as StatsD gauges over UDP.
+type statsdSink struct {
+	addr string
+	conn net.Conn
+}
+
+func (s *statsdSink) write(points []forwardPoint) (int, error) {
+	if s.conn == nil {
+		conn, err := net.Dial("udp", s.addr)
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+	}
+	var buf bytes.Buffer
+	// the points of the datagrams already sent
+	sent := 0
+	for i, p := range points {
+		if !p.numeric {
+			continue
+		}
+		line := statsdLine(p)
+		if buf.Len() > 0 && buf.Len()+len(line) > statsdMaxPacket {
+			if _, err := s.conn.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))); err != nil {
+				return sent, err
+			}
+			buf.Reset()
+			sent = i
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))); err != nil {
+			return sent, err
+		}
+	}
+	return len(points), nil
+}
+
+func (s *statsdSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// statsdLine formats a point as the gauge `name:value|g`.
+func statsdLine(p forwardPoint) string {
+	name := strings.NewReplacer(" ", "_", ":", "_", "|", "_").Replace(p.name)
+	line := fmt.Sprintf("%s:%s|g\n", name, strconv.FormatFloat(p.value, 'g', -1, 64))
+	// a signed gauge value is applied as a delta, so reset the gauge first
+	if p.value < 0 {
+		return name + ":0|g\n" + line
+	}
+	return line
+}
@@ -0,0 +1,234 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testForwardPoints(n int) []forwardPoint {
+	ts := time.Unix(1500000000, 0)
+	points := make([]forwardPoint, n)
+	for i := range points {
+		points[i] = forwardPoint{
+			name:      fmt.Sprintf("intel.mock.foo%d", i),
+			tags:      map[string]string{"task_id": "t1"},
+			data:      i,
+			value:     float64(i),
+			numeric:   true,
+			timestamp: ts,
+		}
+	}
+	return points
+}
+
+func TestForwardMetricName(t *testing.T) {
+	mappings, err := parseNameMappings([]string{`^/intel/procfs/load/(.*)$=load.$1`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ns   string
+		want string
+	}{
+		{"/intel/procfs/load/min1", "load.min1"},
+		{"/intel/mock/foo", "intel.mock.foo"},
+		{"/intel/mock/1.5 ms", "intel.mock.1_5_ms"},
+		{"|intel|mock|bar", "intel.mock.bar"},
+	}
+	for _, tt := range tests {
+		if got := forwardMetricName(tt.ns, mappings); got != tt.want {
+			t.Errorf("forwardMetricName(%q) = %q, want %q", tt.ns, got, tt.want)
+		}
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	points := testForwardPoints(3)
+	points[1].numeric = false
+	sink := &graphiteSink{addr: l.Addr().String()}
+	defer sink.close()
+	if n, err := sink.write(points); err != nil || n != 3 {
+		t.Fatalf("write() = %d, %v, want 3, nil", n, err)
+	}
+	for _, want := range []string{"intel.mock.foo0 0 1500000000", "intel.mock.foo2 2 1500000000"} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("got line %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("line %q not received", want)
+		}
+	}
+}
+
+func TestStatsdSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// enough points for several datagrams
+	points := testForwardPoints(200)
+	points[3].value = -3
+	sink := &statsdSink{addr: pc.LocalAddr().String()}
+	defer sink.close()
+	if n, err := sink.write(points); err != nil || n != len(points) {
+		t.Fatalf("write() = %d, %v, want %d, nil", n, err, len(points))
+	}
+
+	var got []string
+	buf := make([]byte, 65536)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(got) < len(points)+1 {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("%d lines received: %v", len(got), err)
+		}
+		if n > statsdMaxPacket {
+			t.Errorf("datagram of %d bytes, more than %d", n, statsdMaxPacket)
+		}
+		got = append(got, strings.Split(string(buf[:n]), "\n")...)
+	}
+	if got[0] != "intel.mock.foo0:0|g" {
+		t.Errorf("got first line %q", got[0])
+	}
+	// a negative gauge is reset first
+	if got[3] != "intel.mock.foo3:0|g" || got[4] != "intel.mock.foo3:-3|g" {
+		t.Errorf("got lines %q for a negative value", got[3:5])
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantN   int
+		wantErr interface{}
+	}{
+		{http.StatusNoContent, 2, nil},
+		{http.StatusBadRequest, 0, forwardRejectedError{}},
+		{http.StatusUnauthorized, 0, forwardAuthError{}},
+		{http.StatusForbidden, 0, forwardAuthError{}},
+		{http.StatusInternalServerError, 0, errors.New("")},
+	}
+	for _, tt := range tests {
+		var body string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(tt.status)
+		}))
+		sink, err := newForwardSink("influx://" + strings.TrimPrefix(srv.URL, "http://") + "/db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := sink.write(testForwardPoints(2))
+		srv.Close()
+		if n != tt.wantN || fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tt.wantErr) {
+			t.Errorf("status %d: write() = %d, %T, want %d, %T", tt.status, n, err, tt.wantN, tt.wantErr)
+		}
+		if want := "intel.mock.foo0,task_id=t1 value=0 1500000000000000000\n"; !strings.HasPrefix(body, want) {
+			t.Errorf("status %d: body %q, want it to start with %q", tt.status, body, want)
+		}
+	}
+}
+
+// failingSink writes the points until it has written max of them, then fails.
+type failingSink struct {
+	written []forwardPoint
+	max     int
+	err     error
+}
+
+func (s *failingSink) write(points []forwardPoint) (int, error) {
+	n := len(points)
+	if room := s.max - len(s.written); room < n {
+		n = room
+	}
+	s.written = append(s.written, points[:n]...)
+	if n < len(points) {
+		return n, s.err
+	}
+	return n, nil
+}
+
+func (s *failingSink) close() {}
+
+func TestFlushForwardPoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int
+		err       error
+		wantLeft  int
+		wantError bool
+	}{
+		{"all written", 10, nil, 0, false},
+		{"partial write", 5, errors.New("connection reset"), 5, false},
+		{"rejected", 5, forwardRejectedError{"bad points"}, 0, false},
+		{"unauthorized", 5, forwardAuthError{"unauthorized"}, 7, true},
+	}
+	for _, tt := range tests {
+		sink := &failingSink{max: tt.max, err: tt.err}
+		points := testForwardPoints(10)
+		left, err := flushForwardPoints(sink, points, 3)
+		if len(left) != tt.wantLeft || (err != nil) != tt.wantError {
+			t.Errorf("%s: %d point(s) left, error %v, want %d, %v", tt.name, len(left), err, tt.wantLeft, tt.wantError)
+			continue
+		}
+		// the points written are not sent again
+		if tt.err != nil && !tt.wantError {
+			if _, rejected := tt.err.(forwardRejectedError); !rejected && left[0].name != points[len(sink.written)].name {
+				t.Errorf("%s: retrying from %s after %d point(s) written", tt.name, left[0].name, len(sink.written))
+			}
+		}
+		if e, ok := err.(*APIError); tt.wantError && (!ok || e.Code != ExitUnauthorized) {
+			t.Errorf("%s: error %#v, want an unauthorized APIError", tt.name, err)
+		}
+	}
+}
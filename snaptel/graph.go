@@ -0,0 +1,293 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/intelsdi-x/snap-client-go/client/tasks"
+	"github.com/urfave/cli"
+)
+
+const (
+	// the number of metrics and config values shown in a node
+	graphMaxLines = 10
+	// config values longer than this are cut
+	graphMaxValue = 32
+)
+
+// graphNode is a step of a workflow: the collect node, a processor or a
+// publisher.
+type graphNode struct {
+	kind     string
+	name     string
+	version  string
+	lines    []string
+	children []*graphNode
+}
+
+func graphTask(ctx *cli.Context) error {
+	wf, err := graphWorkflow(ctx)
+	if err != nil {
+		return err
+	}
+	root, err := buildGraph(wf)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch f := strings.ToLower(ctx.String("format")); f {
+	case "", "ascii":
+		writeASCIIGraph(&buf, root, "", "")
+	case "dot":
+		writeDotGraph(&buf, root)
+	case "mermaid":
+		writeMermaidGraph(&buf, root)
+	default:
+		return newUsageError(fmt.Sprintf("Unsupported graph format '%s' (expected dot, mermaid or ascii)", f), ctx)
+	}
+	os.Stdout.Write(buf.Bytes())
+	return nil
+}
+
+// graphWorkflow returns the workflow of the task given by ID or of the task or
+// workflow manifest given with --task-manifest, as a generic JSON map.
+func graphWorkflow(ctx *cli.Context) (map[string]interface{}, error) {
+	var bts []byte
+	if path := ctx.String("task-manifest"); path != "" {
+		if len(ctx.Args()) > 0 {
+			return nil, newUsageError("Incorrect usage: provide either a task ID or --task-manifest", ctx)
+		}
+		file, _, err := readManifest(path, "")
+		if err != nil {
+			return nil, err
+		}
+		if docs := splitYAMLDocuments(file); len(docs) > 1 {
+			return nil, fmt.Errorf("Error: %s holds %d tasks; graph them one at a time", path, len(docs))
+		}
+		// JSON being YAML, both formats go through the YAML parser
+		b, err := yamlToJSON(file)
+		if err != nil {
+			return nil, withManifestFile(err, path, 0)
+		}
+		bts = b
+	} else {
+		if len(ctx.Args()) != 1 {
+			return nil, newUsageError("Incorrect usage: provide either a task ID or --task-manifest", ctx)
+		}
+		params := tasks.NewGetTaskParamsWithTimeout(FlTimeout.Value)
+		params.SetID(ctx.Args().First())
+		resp, err := client.Tasks.GetTask(params, authInfoWriter)
+		if err != nil {
+			return nil, getErrorDetail(err)
+		}
+		b, err := json.Marshal(resp.Payload)
+		if err != nil {
+			return nil, err
+		}
+		bts = b
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(bts, &doc); err != nil {
+		return nil, fmt.Errorf("Error parsing JSON file: %v", err)
+	}
+	// a task manifest holds the workflow under "workflow", a workflow
+	// manifest is the workflow itself
+	if wf, ok := doc["workflow"].(map[string]interface{}); ok {
+		return wf, nil
+	}
+	return doc, nil
+}
+
+// buildGraph turns a workflow into the tree of its nodes.
+func buildGraph(wf map[string]interface{}) (*graphNode, error) {
+	collect, ok := wf["collect"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Error: the workflow has no collect node")
+	}
+	root := &graphNode{kind: "collect"}
+
+	var metrics []string
+	if m, ok := collect["metrics"].(map[string]interface{}); ok {
+		for ns := range m {
+			metrics = append(metrics, ns)
+		}
+	}
+	sort.Strings(metrics)
+	root.name = fmt.Sprintf("%d metric(s)", len(metrics))
+	root.lines = limitLines(metrics)
+	root.children = graphChildren(collect)
+	return root, nil
+}
+
+// graphChildren returns the processors and publishers following a node.
+func graphChildren(node map[string]interface{}) []*graphNode {
+	var out []*graphNode
+	for _, kind := range []string{"process", "publish"} {
+		steps, _ := node[kind].([]interface{})
+		for _, s := range steps {
+			step, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			n := &graphNode{kind: "processor", name: fmt.Sprint(step["plugin_name"])}
+			if kind == "publish" {
+				n.kind = "publisher"
+			}
+			if v, ok := step["plugin_version"]; ok {
+				n.version = fmt.Sprint(v)
+			}
+			if cfg, ok := step["config"].(map[string]interface{}); ok {
+				n.lines = limitLines(configLines(cfg))
+			}
+			n.children = graphChildren(step)
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// configLines formats the config values of a node as key=value, hiding the
+// ones which look like secrets.
+func configLines(cfg map[string]interface{}) []string {
+	var keys []string
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := fmt.Sprint(cfg[k])
+		lk := strings.ToLower(k)
+		for _, secret := range []string{"password", "secret", "token", "key"} {
+			if strings.Contains(lk, secret) {
+				v = "***"
+				break
+			}
+		}
+		if r := []rune(v); len(r) > graphMaxValue {
+			v = string(r[:graphMaxValue-3]) + "..."
+		}
+		lines = append(lines, k+"="+v)
+	}
+	return lines
+}
+
+func limitLines(lines []string) []string {
+	if len(lines) <= graphMaxLines {
+		return lines
+	}
+	return append(lines[:graphMaxLines-1:graphMaxLines-1], fmt.Sprintf("... %d more", len(lines)-graphMaxLines+1))
+}
+
+// title is the first line of a node, e.g. "processor passthru:1".
+func (n *graphNode) title() string {
+	if n.kind == "collect" {
+		return "collect (" + n.name + ")"
+	}
+	if n.version != "" {
+		return n.kind + " " + n.name + ":" + n.version
+	}
+	return n.kind + " " + n.name
+}
+
+// walk calls fn for every node and the ID of its parent, depth first.
+func (n *graphNode) walk(fn func(id, parent int, n *graphNode)) {
+	next := 0
+	var visit func(n *graphNode, parent int)
+	visit = func(n *graphNode, parent int) {
+		id := next
+		next++
+		fn(id, parent, n)
+		for _, c := range n.children {
+			visit(c, id)
+		}
+	}
+	visit(n, -1)
+}
+
+// writeASCIIGraph draws the tree of nodes, e.g.
+//
+//	collect (2 metric(s))
+//	  /intel/mock/bar
+//	  /intel/mock/foo
+//	└── processor passthru:1
+//	    └── publisher file
+//	          file=/tmp/published
+func writeASCIIGraph(buf *bytes.Buffer, n *graphNode, prefix, branch string) {
+	buf.WriteString(prefix + branch + n.title() + "\n")
+	switch branch {
+	case "├── ":
+		prefix += "│   "
+	case "└── ":
+		prefix += "    "
+	}
+	for _, l := range n.lines {
+		buf.WriteString(prefix + "  " + l + "\n")
+	}
+	for i, c := range n.children {
+		b := "├── "
+		if i == len(n.children)-1 {
+			b = "└── "
+		}
+		writeASCIIGraph(buf, c, prefix, b)
+	}
+}
+
+func writeDotGraph(buf *bytes.Buffer, root *graphNode) {
+	shapes := map[string]string{"collect": "box", "processor": "ellipse", "publisher": "cylinder"}
+	buf.WriteString("digraph workflow {\n  rankdir=LR;\n")
+	root.walk(func(id, parent int, n *graphNode) {
+		label := strings.Join(append([]string{n.title()}, n.lines...), "\n")
+		fmt.Fprintf(buf, "  n%d [shape=%s, label=%s];\n", id, shapes[n.kind], dotQuote(label))
+		if parent >= 0 {
+			fmt.Fprintf(buf, "  n%d -> n%d;\n", parent, id)
+		}
+	})
+	buf.WriteString("}\n")
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\l`).Replace(s) + `\l"`
+}
+
+func writeMermaidGraph(buf *bytes.Buffer, root *graphNode) {
+	shapes := map[string][2]string{"collect": {"[", "]"}, "processor": {"(", ")"}, "publisher": {"[(", ")]"}}
+	buf.WriteString("flowchart LR\n")
+	root.walk(func(id, parent int, n *graphNode) {
+		label := strings.Join(append([]string{n.title()}, n.lines...), "<br/>")
+		s := shapes[n.kind]
+		fmt.Fprintf(buf, "  n%d%s\"%s\"%s\n", id, s[0], mermaidEscape(label), s[1])
+		if parent >= 0 {
+			fmt.Fprintf(buf, "  n%d --> n%d\n", parent, id)
+		}
+	})
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<br/>", "<br/>", "<", "#lt;", ">", "#gt;").Replace(s)
+}
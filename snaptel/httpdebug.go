@@ -0,0 +1,296 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugBodyLimit is the number of bytes of the bodies logged by --debug-http.
+const debugBodyLimit = 2048
+
+// debugOut serializes the logs of the requests, which the dashboard sends
+// concurrently.
+var debugOut = struct {
+	sync.Mutex
+	w io.Writer
+}{w: os.Stderr}
+
+func debugPrint(s string) {
+	debugOut.Lock()
+	defer debugOut.Unlock()
+	fmt.Fprint(debugOut.w, s)
+}
+
+// NewDebugTransport wraps the transport of the HTTP clients to log on stderr
+// the requests and responses, with --debug-http, and the latencies of their
+// stages, with --timing.
+func NewDebugTransport(rt http.RoundTripper, dump, timing bool) http.RoundTripper {
+	if !dump && !timing {
+		return rt
+	}
+	return &debugTransport{rt: rt, dump: dump, timing: timing}
+}
+
+type debugTransport struct {
+	rt     http.RoundTripper
+	dump   bool
+	timing bool
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the request is not modified, a copy is sent
+	ctx := req.Context()
+	var timing *requestTiming
+	if t.timing {
+		timing = &requestTiming{method: req.Method, url: req.URL.String(), start: time.Now()}
+		ctx = httptrace.WithClientTrace(ctx, timing.trace())
+	}
+	out := req.WithContext(ctx)
+	if t.dump {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "> %s %s\n", req.Method, req.URL)
+		writeHeaders(&b, "> ", req.Header)
+		debugPrint(b.String())
+		if req.Body != nil {
+			out.Body = newDebugBody(req.Body, "> ", req.Header.Get("Content-Type"), nil)
+		}
+	}
+
+	resp, err := t.rt.RoundTrip(out)
+	if err != nil {
+		if t.dump {
+			debugPrint(fmt.Sprintf("< %v\n", err))
+		}
+		if timing != nil {
+			timing.report()
+		}
+		return nil, err
+	}
+
+	prefix := ""
+	if t.dump {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "< %s %s\n", resp.Proto, resp.Status)
+		writeHeaders(&b, "< ", resp.Header)
+		debugPrint(b.String())
+		prefix = "< "
+	}
+	if t.dump || timing != nil {
+		var done func()
+		if timing != nil {
+			done = timing.report
+		}
+		resp.Body = newDebugBody(resp.Body, prefix, resp.Header.Get("Content-Type"), done)
+	}
+	return resp, nil
+}
+
+// writeHeaders writes headers sorted by name, with the values of the ones
+// which may hold credentials redacted.
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			if isCredentialHeader(name) {
+				v = "[redacted]"
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, v)
+		}
+	}
+}
+
+func isCredentialHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"auth", "token", "cookie", "secret", "key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextContent tells whether a body of a content type can be logged.
+func isTextContent(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	for _, s := range []string{"json", "text/", "yaml", "xml", "x-www-form-urlencoded"} {
+		if strings.Contains(ct, s) {
+			return true
+		}
+	}
+	return ct == ""
+}
+
+// debugBody logs the first bytes of a body as they are read, which does not
+// hold up the event streams of watch, and calls done once it is read or
+// closed. The transport may close it while another goroutine reads it.
+type debugBody struct {
+	io.ReadCloser
+	prefix string // "" for a body not logged
+	text   bool
+	done   func()
+	finish sync.Once
+
+	mu     sync.Mutex
+	head   bytes.Buffer
+	size   int
+	logged bool
+}
+
+func newDebugBody(rc io.ReadCloser, prefix, contentType string, done func()) *debugBody {
+	return &debugBody{ReadCloser: rc, prefix: prefix, text: isTextContent(contentType), done: done}
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.size += n
+	if b.prefix != "" && b.text && b.head.Len() < debugBodyLimit {
+		room := debugBodyLimit - b.head.Len()
+		if room > n {
+			room = n
+		}
+		b.head.Write(p[:room])
+		if b.head.Len() == debugBodyLimit {
+			b.log()
+		}
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.end()
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	b.end()
+	return b.ReadCloser.Close()
+}
+
+func (b *debugBody) end() {
+	b.finish.Do(func() {
+		if b.prefix != "" {
+			b.mu.Lock()
+			b.log()
+			b.mu.Unlock()
+		}
+		if b.done != nil {
+			b.done()
+		}
+	})
+}
+
+// log logs the head of the body once: when it reaches the limit, or else at
+// the end of the body.
+func (b *debugBody) log() {
+	if b.logged {
+		return
+	}
+	b.logged = true
+	var out bytes.Buffer
+	switch {
+	case !b.text:
+		fmt.Fprintf(&out, "%s[binary body, %d bytes]\n", b.prefix, b.size)
+	case b.head.Len() == 0:
+		return
+	default:
+		for _, line := range strings.Split(strings.TrimRight(b.head.String(), "\n"), "\n") {
+			fmt.Fprintf(&out, "%s%s\n", b.prefix, line)
+		}
+		if b.head.Len() == debugBodyLimit {
+			fmt.Fprintf(&out, "%s[first %d bytes shown]\n", b.prefix, debugBodyLimit)
+		}
+	}
+	debugPrint(out.String())
+}
+
+// requestTiming holds the times of the stages of a request, set by the
+// callbacks of httptrace from the goroutines of the transport.
+type requestTiming struct {
+	sync.Mutex
+	method, url string
+	start       time.Time
+	dnsStart    time.Time
+	dnsDone     time.Time
+	connStart   time.Time
+	connDone    time.Time
+	tlsStart    time.Time
+	tlsDone     time.Time
+	firstByte   time.Time
+	reused      bool
+}
+
+func (rt *requestTiming) trace() *httptrace.ClientTrace {
+	set := func(t *time.Time) {
+		rt.Lock()
+		defer rt.Unlock()
+		if t.IsZero() {
+			*t = time.Now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&rt.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&rt.dnsDone) },
+		ConnectStart:         func(string, string) { set(&rt.connStart) },
+		ConnectDone:          func(string, string, error) { set(&rt.connDone) },
+		TLSHandshakeStart:    func() { set(&rt.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&rt.tlsDone) },
+		GotFirstResponseByte: func() { set(&rt.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.Lock()
+			defer rt.Unlock()
+			rt.reused = info.Reused
+		},
+	}
+}
+
+// report logs the latencies of the stages of the request: DNS lookup,
+// connection, TLS handshake, first byte of the response since the start and
+// total until the response is read.
+func (rt *requestTiming) report() {
+	rt.Lock()
+	defer rt.Unlock()
+	stage := func(from, to time.Time) string {
+		if from.IsZero() || to.IsZero() {
+			return "-"
+		}
+		return fmt.Sprintf("%.1fms", float64(to.Sub(from))/float64(time.Millisecond))
+	}
+	conn := fmt.Sprintf("dns %s, connect %s, tls %s", stage(rt.dnsStart, rt.dnsDone), stage(rt.connStart, rt.connDone), stage(rt.tlsStart, rt.tlsDone))
+	if rt.reused {
+		conn = "connection reused"
+	}
+	debugPrint(fmt.Sprintf("Timing %s %s: %s, first byte %s, total %s\n",
+		rt.method, rt.url, conn, stage(rt.start, rt.firstByte), stage(rt.start, time.Now())))
+}
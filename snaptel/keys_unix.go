@@ -0,0 +1,56 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// setKeyTimeout makes the reads of the terminal in raw mode return empty when
+// no key is pressed within keyPollInterval.
+func setKeyTimeout(fd int) error {
+	var t syscall.Termios
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlReadTermios, uintptr(unsafe.Pointer(&t))); e != 0 {
+		return e
+	}
+	t.Cc[syscall.VMIN] = 0
+	t.Cc[syscall.VTIME] = uint8(keyPollInterval / (100 * time.Millisecond))
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlWriteTermios, uintptr(unsafe.Pointer(&t))); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// readKey reads the keys pressed, if any within keyPollInterval.
+func readKey(fd int, buf []byte) (int, error) {
+	n, err := os.Stdin.Read(buf)
+	if err == io.EOF {
+		// the read timed out
+		return 0, nil
+	}
+	return n, err
+}
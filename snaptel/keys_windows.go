@@ -0,0 +1,45 @@
+//go:build windows
+// +build windows
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// setKeyTimeout is a no-op on Windows where readKey waits for the console
+// instead.
+func setKeyTimeout(fd int) error { return nil }
+
+// readKey reads the keys pressed, if any within keyPollInterval.
+func readKey(fd int, buf []byte) (int, error) {
+	ev, err := syscall.WaitForSingleObject(syscall.Handle(fd), uint32(keyPollInterval/time.Millisecond))
+	if err != nil {
+		return 0, err
+	}
+	if ev == syscall.WAIT_TIMEOUT {
+		return 0, nil
+	}
+	return os.Stdin.Read(buf)
+}
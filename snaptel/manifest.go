@@ -0,0 +1,405 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+func convertManifest(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return newUsageError("Incorrect usage: a single manifest file is required", ctx)
+	}
+	path := ctx.Args().First()
+	from, err := manifestFormat(path)
+	if err != nil {
+		return newUsageError(err.Error(), ctx)
+	}
+	to := strings.ToLower(ctx.String("to"))
+	switch to {
+	case "":
+		// convert to the other format by default
+		to = "yaml"
+		if from == "yaml" {
+			to = "json"
+		}
+	case "json", "yaml":
+	case "yml":
+		to = "yaml"
+	default:
+		return newUsageError(fmt.Sprintf("Unsupported output format '%s' (expected json or yaml)", to), ctx)
+	}
+
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("File error [%s] - %v", filepath.Ext(path), err)
+	}
+	docs, err := decodeManifests(bts, from)
+	if err != nil {
+		return withManifestFile(err, path, 0)
+	}
+	if len(docs) > 1 && (to == "json" || ctx.Bool("wrap-workflow")) {
+		return fmt.Errorf("Error: %s holds %d documents; only a single one can be converted to JSON or wrapped", path, len(docs))
+	}
+	if from == "yaml" && hasYAMLComments(bts) {
+		fmt.Fprintf(os.Stderr, "Warning: the comments of %s are not preserved\n", path)
+	}
+
+	if ctx.Bool("wrap-workflow") {
+		docs[0], err = wrapWorkflow(ctx, bts, from, docs[0])
+		if err != nil {
+			return withManifestFile(err, path, 0)
+		}
+	}
+
+	out, err := encodeManifests(docs, to)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+	return nil
+}
+
+func formatManifests(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return newUsageError("Incorrect usage: at least one manifest file is required", ctx)
+	}
+	for _, path := range ctx.Args() {
+		format, err := manifestFormat(path)
+		if err != nil {
+			return newUsageError(err.Error(), ctx)
+		}
+		bts, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("File error [%s] - %v", filepath.Ext(path), err)
+		}
+		if format == "yaml" && hasYAMLComments(bts) && !ctx.Bool("force") {
+			return fmt.Errorf("Error: %s has comments which formatting would remove; use --force to format it anyway", path)
+		}
+		docs, err := decodeManifests(bts, format)
+		if err != nil {
+			switch err.(type) {
+			case *manifestError, manifestErrors:
+				return withManifestFile(err, path, 0)
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		out, err := encodeManifests(docs, format)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if bytes.Equal(out, bts) {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, out, fi.Mode()); err != nil {
+			return fmt.Errorf("Error writing %s: %v", path, err)
+		}
+		fmt.Printf("Formatted %s\n", path)
+	}
+	return nil
+}
+
+// manifestFormat returns the format of a manifest file from its extension.
+func manifestFormat(path string) (string, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".json":
+		return "json", nil
+	default:
+		return "", fmt.Errorf("Unsupported file type %s", ext)
+	}
+}
+
+// decodeManifest decodes a manifest keeping the order of the keys of its
+// objects, which are returned as yaml.MapSlice.
+func decodeManifest(bts []byte, format string) (interface{}, error) {
+	if format == "json" {
+		return decodeOrderedJSON(bts)
+	}
+	// make sure the manifest is a valid one in the first place
+	if _, err := yamlToJSON(bts); err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(bts, &doc); err != nil {
+		return nil, yamlSyntaxError(err)
+	}
+	return doc, nil
+}
+
+// decodeManifests decodes every document of a manifest, of which a YAML
+// stream may hold several.
+func decodeManifests(bts []byte, format string) ([]interface{}, error) {
+	var parts []yamlDocument
+	if format == "yaml" {
+		parts = splitYAMLDocuments(bts)
+	}
+	if len(parts) <= 1 {
+		doc, err := decodeManifest(bts, format)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{doc}, nil
+	}
+	docs := make([]interface{}, 0, len(parts))
+	for _, p := range parts {
+		doc, err := decodeManifest(p.bts, format)
+		if err != nil {
+			return nil, withManifestFile(err, "", p.line-1)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// encodeManifests is the canonical form of the documents of a manifest, YAML
+// ones separated by "---".
+func encodeManifests(docs []interface{}, format string) ([]byte, error) {
+	if len(docs) > 1 && format != "yaml" {
+		return nil, fmt.Errorf("Error: %d documents cannot be written as JSON", len(docs))
+	}
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		out, err := encodeManifest(doc, format)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeManifest is the canonical form of a manifest: JSON indented by two
+// spaces, or YAML as written by yaml.v2.
+func encodeManifest(doc interface{}, format string) ([]byte, error) {
+	if format == "yaml" {
+		return yaml.Marshal(doc)
+	}
+	var buf bytes.Buffer
+	if err := writeOrderedJSON(&buf, doc, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// wrapWorkflow turns a workflow manifest into a task manifest whose schedule
+// and options come from the CLI flags.
+func wrapWorkflow(ctx *cli.Context, bts []byte, format string, workflow interface{}) (interface{}, error) {
+	var t *models.Task
+	var err error
+	if format == "yaml" {
+		t, err = wfYamlToJSON(ctx, bts)
+	} else {
+		t, err = wfJSONtoJSON(ctx, bts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := json.Marshal(t.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := decodeOrderedJSON(sb)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := yaml.MapSlice{
+		{Key: "version", Value: t.Version},
+		{Key: "schedule", Value: schedule},
+	}
+	if t.Name != "" {
+		doc = append(doc, yaml.MapItem{Key: "name", Value: t.Name})
+	}
+	if t.Deadline != "" {
+		doc = append(doc, yaml.MapItem{Key: "deadline", Value: t.Deadline})
+	}
+	if t.MaxFailures != 0 {
+		doc = append(doc, yaml.MapItem{Key: "max-failures", Value: t.MaxFailures})
+	}
+	if t.MaxCollectDuration != "" {
+		doc = append(doc, yaml.MapItem{Key: "max-collect-duration", Value: t.MaxCollectDuration})
+	}
+	if t.MaxMetricsBuffer != 0 {
+		doc = append(doc, yaml.MapItem{Key: "max-metrics-buffer", Value: t.MaxMetricsBuffer})
+	}
+	return append(doc, yaml.MapItem{Key: "workflow", Value: workflow}), nil
+}
+
+// decodeOrderedJSON decodes JSON into the types yaml.v2 produces, objects
+// becoming yaml.MapSlice so that the order of their keys is kept.
+func decodeOrderedJSON(bts []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(bts))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return nil, jsonDecodeError(bts, err)
+		}
+		return nil, fmt.Errorf("Error parsing JSON file: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Error parsing JSON file: unexpected data after the top-level value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := yaml.MapSlice{}
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, yaml.MapItem{Key: k, Value: v})
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			l := []interface{}{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, v)
+			}
+			_, err := dec.Token()
+			return l, err
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return tok, nil
+}
+
+// writeOrderedJSON writes v as indented JSON, keeping the order of the keys of
+// yaml.MapSlice values.
+func writeOrderedJSON(buf *bytes.Buffer, v interface{}, indent string) error {
+	switch x := v.(type) {
+	case yaml.MapSlice:
+		if len(x) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, item := range x {
+			k, err := json.Marshal(fmt.Sprint(item.Key))
+			if err != nil {
+				return err
+			}
+			buf.WriteString(indent + "  ")
+			buf.Write(k)
+			buf.WriteString(": ")
+			if err := writeOrderedJSON(buf, item.Value, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(x)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(x) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, e := range x {
+			buf.WriteString(indent + "  ")
+			if err := writeOrderedJSON(buf, e, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(x)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// hasYAMLComments tells whether a YAML document has comments, which yaml.v2
+// does not keep.
+func hasYAMLComments(bts []byte) bool {
+	for _, line := range strings.Split(string(bts), "\n") {
+		var quote rune
+		prev := ' '
+		for _, c := range line {
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '#' && (prev == ' ' || prev == '\t'):
+				return true
+			}
+			prev = c
+		}
+	}
+	return false
+}
@@ -182,7 +182,7 @@ func queryMetrics(ctx *cli.Context) ([]*models.Metric, error) {
 
 	resp, err := client.Plugins.GetMetrics(params, authInfoWriter)
 	if err != nil {
-		return nil, getErrorDetail(err, ctx)
+		return nil, getErrorDetail(err)
 	}
 
 	if (len(ns) > 0 || ver > 0) && len(resp.Payload.Metrics) == 0 {
@@ -93,7 +93,7 @@ func loadPlugin(ctx *cli.Context) error {
 
 		resp, err := client.Plugins.LoadPlugin(params, authInfoWriter)
 		if err != nil {
-			return getErrorDetail(err, ctx)
+			return getErrorDetail(err)
 		}
 		p = resp.Payload
 	} else {
@@ -103,7 +103,7 @@ func loadPlugin(ctx *cli.Context) error {
 
 		resp, err := client.Plugins.LoadPlugin(params, authInfoWriter)
 		if err != nil {
-			return getErrorDetail(err, ctx)
+			return getErrorDetail(err)
 		}
 		p = resp.Payload
 	}
@@ -152,7 +152,7 @@ func unloadPlugin(ctx *cli.Context) error {
 
 	_, err = client.Plugins.UnloadPlugin(params, authInfoWriter)
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return getErrorDetail(err)
 	}
 
 	fmt.Println("Plugin unloaded")
@@ -163,8 +163,8 @@ func unloadPlugin(ctx *cli.Context) error {
 	return nil
 }
 
-func listPlugins(ctx *cli.Context) error {
-	running := ctx.Bool("running")
+// fetchPlugins returns the loaded plugins, or the running ones.
+func fetchPlugins(running bool) ([]*models.Plugin, error) {
 	params := plugins.NewGetPluginsParamsWithTimeout(FlTimeout.Value)
 	if running {
 		params.SetRunning(&running)
@@ -172,10 +172,19 @@ func listPlugins(ctx *cli.Context) error {
 
 	resp, err := client.Plugins.GetPlugins(params, authInfoWriter)
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return nil, err
+	}
+	return resp.Payload.Plugins, nil
+}
+
+func listPlugins(ctx *cli.Context) error {
+	running := ctx.Bool("running")
+	plgs, err := fetchPlugins(running)
+	if err != nil {
+		return getErrorDetail(err)
 	}
 
-	lps := len(resp.Payload.Plugins)
+	lps := len(plgs)
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 	if running {
@@ -185,7 +194,7 @@ func listPlugins(ctx *cli.Context) error {
 		}
 
 		printFields(w, false, 0, "NAME", "HIT COUNT", "LAST HIT", "TYPE", "PPROF PORT")
-		for _, rp := range resp.Payload.Plugins {
+		for _, rp := range plgs {
 			printFields(w, false, 0, rp.Name, rp.HitCount, time.Unix(rp.LastHitTimestamp, 0).Format(time.RFC1123), rp.Type, rp.PprofPort)
 		}
 	} else {
@@ -194,7 +203,7 @@ func listPlugins(ctx *cli.Context) error {
 			return nil
 		}
 		printFields(w, false, 0, "NAME", "VERSION", "TYPE", "SIGNED", "STATUS", "LOADED TIME")
-		for _, lp := range resp.Payload.Plugins {
+		for _, lp := range plgs {
 			printFields(w, false, 0, lp.Name, lp.Version, lp.Type, lp.Signed, lp.Status, time.Unix(lp.LoadedTimestamp, 0).Format(time.RFC1123))
 		}
 	}
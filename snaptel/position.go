@@ -0,0 +1,399 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// manifestError is an error found in a manifest, located by its line and
+// column (1-based, 0 when unknown) and by the path of the offending key.
+type manifestError struct {
+	file string
+	line int
+	col  int
+	path string
+	msg  string
+}
+
+func (e *manifestError) Error() string {
+	var loc []string
+	if e.file != "" {
+		loc = append(loc, e.file)
+	}
+	if e.line > 0 {
+		loc = append(loc, strconv.Itoa(e.line))
+		if e.col > 0 {
+			loc = append(loc, strconv.Itoa(e.col))
+		}
+	}
+	msg := e.msg
+	if e.path != "" {
+		msg = e.path + ": " + msg
+	}
+	if len(loc) == 0 {
+		return "Error: " + msg
+	}
+	return strings.Join(loc, ":") + ": " + msg
+}
+
+// manifestErrors are all the errors found in a manifest, one per line.
+type manifestErrors []*manifestError
+
+func (e manifestErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, m := range e {
+		lines = append(lines, m.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withManifestFile sets the file name of the errors found in a manifest, and
+// shifts their lines by offset when the manifest is a document starting
+// further down a file.
+func withManifestFile(err error, file string, offset int) error {
+	set := func(m *manifestError) {
+		m.file = file
+		if m.line > 0 {
+			m.line += offset
+		}
+	}
+	switch e := err.(type) {
+	case *manifestError:
+		set(e)
+	case manifestErrors:
+		for _, m := range e {
+			set(m)
+		}
+	}
+	return err
+}
+
+// formatKeyPath joins a path of object keys and array indexes, e.g.
+// workflow.collect.process[0].plugin_name.
+func formatKeyPath(path []interface{}) string {
+	var buf bytes.Buffer
+	for _, p := range path {
+		switch x := p.(type) {
+		case int:
+			fmt.Fprintf(&buf, "[%d]", x)
+		default:
+			if buf.Len() > 0 {
+				buf.WriteString(".")
+			}
+			buf.WriteString(fmt.Sprint(x))
+		}
+	}
+	return buf.String()
+}
+
+// splitKeyPath splits the dotted path of a struct field given by the JSON
+// decoder.
+func splitKeyPath(field string) []interface{} {
+	var path []interface{}
+	for _, p := range strings.Split(field, ".") {
+		path = append(path, p)
+	}
+	return path
+}
+
+// offsetPosition turns a byte offset into a line and a column.
+func offsetPosition(src []byte, off int) (int, int) {
+	if off > len(src) {
+		off = len(src)
+	}
+	if off < 0 {
+		off = 0
+	}
+	line := bytes.Count(src[:off], []byte("\n")) + 1
+	col := off - bytes.LastIndex(src[:off], []byte("\n"))
+	return line, col
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlSyntaxError turns an error of the YAML parser, which only knows the
+// line, into a manifestError.
+func yamlSyntaxError(err error) error {
+	if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &manifestError{line: line, msg: m[2]}
+	}
+	return &manifestError{msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+// jsonDecodeError turns an error of the JSON decoder into a manifestError
+// located in src. Type errors are located by the path of their field when the
+// decoder knows it.
+func jsonDecodeError(src []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// the offset is past the offending byte
+		line, col := offsetPosition(src, int(e.Offset)-1)
+		return &manifestError{line: line, col: col, msg: e.Error()}
+	case *json.UnmarshalTypeError:
+		me := &manifestError{msg: fmt.Sprintf("expected %v, got %s", e.Type, e.Value)}
+		if e.Field != "" {
+			path := splitKeyPath(e.Field)
+			me.path = formatKeyPath(path)
+			me.line, me.col = jsonKeyPosition(src, path)
+		} else {
+			me.line, me.col = offsetPosition(src, int(e.Offset))
+		}
+		return me
+	}
+	return &manifestError{msg: err.Error()}
+}
+
+// yamlLine is a line of a block style YAML document. A sequence entry is split
+// in two: the "-" marker and, indented past it, what follows it.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+	item   bool
+}
+
+func yamlLines(src []byte) []yamlLine {
+	var out []yamlLine
+	for i, l := range strings.Split(string(src), "\n") {
+		text := strings.TrimLeft(l, " ")
+		indent := len(l) - len(text)
+		text = strings.TrimRight(text, " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		for text == "-" || strings.HasPrefix(text, "- ") {
+			out = append(out, yamlLine{num: i + 1, indent: indent, item: true})
+			rest := strings.TrimLeft(text[1:], " ")
+			indent += len(text) - len(rest)
+			text = rest
+		}
+		if text != "" {
+			out = append(out, yamlLine{num: i + 1, indent: indent, text: text})
+		}
+	}
+	return out
+}
+
+// yamlKey returns the key of a "key: value" line, unquoted.
+func yamlKey(text string) (string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.Index(text[1:], text[:1])
+		if end < 0 || !strings.HasPrefix(strings.TrimLeft(text[end+2:], " "), ":") {
+			return "", false
+		}
+		k := text[1 : end+1]
+		if text[0] == '"' {
+			if u, err := strconv.Unquote(text[:end+2]); err == nil {
+				k = u
+			}
+		}
+		return k, true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ' || text[i+1] == '\t') {
+			return strings.TrimRight(text[:i], " \t"), true
+		}
+	}
+	return "", false
+}
+
+// yamlKeyPosition locates a key path in a block style YAML document. When the
+// path cannot be followed to its end, e.g. within a flow style mapping, the
+// position of its deepest key found is returned; 0, 0 when none is found.
+func yamlKeyPosition(src []byte, path []interface{}) (int, int) {
+	lines := yamlLines(src)
+	line, col := 0, 0
+	parent, start := -1, 0
+	for _, p := range path {
+		var found int
+		if idx, ok := p.(int); ok {
+			found = yamlItem(lines, start, parent, idx)
+		} else {
+			found = yamlChildKey(lines, start, parent, fmt.Sprint(p))
+		}
+		if found < 0 {
+			break
+		}
+		line, col = lines[found].num, lines[found].indent+1
+		parent, start = lines[found].indent, found+1
+	}
+	return line, col
+}
+
+// yamlChildKey returns the line of key in the mapping starting at start and
+// indented past parent, -1 when it is not there.
+func yamlChildKey(lines []yamlLine, start, parent int, key string) int {
+	child := -1
+	for i := start; i < len(lines); i++ {
+		l := lines[i]
+		if l.indent <= parent {
+			break
+		}
+		if child < 0 {
+			child = l.indent
+		}
+		if l.item || l.indent != child {
+			continue
+		}
+		if k, ok := yamlKey(l.text); ok && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlItem returns the line of the idx-th entry of the sequence starting at
+// start, -1 when it is not there. A sequence may be indented like the key
+// holding it.
+func yamlItem(lines []yamlLine, start, parent, idx int) int {
+	child := -1
+	for i := start; i < len(lines); i++ {
+		l := lines[i]
+		if l.indent < parent || (!l.item && l.indent <= parent) {
+			break
+		}
+		if !l.item || (child >= 0 && l.indent != child) {
+			continue
+		}
+		child = l.indent
+		if idx == 0 {
+			return i
+		}
+		idx--
+	}
+	return -1
+}
+
+// jsonKeyPosition locates a key path in a JSON document. When the path cannot
+// be followed to its end the position of its deepest element found is
+// returned; 0, 0 when none is found.
+func jsonKeyPosition(src []byte, path []interface{}) (int, int) {
+	s := &jsonScanner{src: src, path: path, found: -1}
+	s.value(0)
+	if s.found < 0 {
+		return 0, 0
+	}
+	return offsetPosition(src, s.found)
+}
+
+// jsonScanner walks a JSON document, recording the offset of the deepest
+// element of path it goes through.
+type jsonScanner struct {
+	src   []byte
+	pos   int
+	path  []interface{}
+	found int
+	err   bool
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.src) && strings.IndexByte(" \t\r\n", s.src[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+// value scans the value at the current offset; depth is the number of
+// elements of the path leading to it, -1 when it is off the path.
+func (s *jsonScanner) value(depth int) {
+	s.skipSpace()
+	if s.err || s.pos >= len(s.src) {
+		s.err = true
+		return
+	}
+	next := func(p interface{}, at int) int {
+		if depth < 0 || depth >= len(s.path) || fmt.Sprint(s.path[depth]) != fmt.Sprint(p) {
+			return -1
+		}
+		s.found = at
+		return depth + 1
+	}
+	switch s.src[s.pos] {
+	case '{':
+		s.pos++
+		for !s.err {
+			s.skipSpace()
+			if s.pos < len(s.src) && s.src[s.pos] == '}' {
+				s.pos++
+				return
+			}
+			at := s.pos
+			k, ok := s.str()
+			s.skipSpace()
+			if !ok || s.pos >= len(s.src) || s.src[s.pos] != ':' {
+				s.err = true
+				return
+			}
+			s.pos++
+			s.value(next(k, at))
+			s.skipSpace()
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			}
+		}
+	case '[':
+		s.pos++
+		for i := 0; !s.err; i++ {
+			s.skipSpace()
+			if s.pos < len(s.src) && s.src[s.pos] == ']' {
+				s.pos++
+				return
+			}
+			s.value(next(i, s.pos))
+			s.skipSpace()
+			if s.pos < len(s.src) && s.src[s.pos] == ',' {
+				s.pos++
+			}
+		}
+	case '"':
+		s.str()
+	default:
+		for s.pos < len(s.src) && strings.IndexByte(",]} \t\r\n", s.src[s.pos]) < 0 {
+			s.pos++
+		}
+	}
+}
+
+func (s *jsonScanner) str() (string, bool) {
+	if s.pos >= len(s.src) || s.src[s.pos] != '"' {
+		return "", false
+	}
+	start := s.pos
+	for s.pos++; s.pos < len(s.src); s.pos++ {
+		switch s.src[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			var v string
+			if err := json.Unmarshal(s.src[start:s.pos], &v); err != nil {
+				return "", false
+			}
+			return v, true
+		}
+	}
+	return "", false
+}
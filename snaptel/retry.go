@@ -0,0 +1,164 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxRetryBackoff bounds the delay before a retry.
+const maxRetryBackoff = 30 * time.Second
+
+// retryRand jitters the delays of the retries, differently for every process.
+var retryRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// NewRetryTransport wraps the transport of the HTTP clients to retry the
+// requests failing to connect or answered with a 5xx status, up to retries
+// times with a jittered exponential backoff: the nth retry waits between half
+// of and backoff*2^(n-1), within the timeout of the request. Only the
+// idempotent requests (GET, HEAD), getting the tasks, plugins, metrics and
+// config items, are retried, unless all is set. The event streams of the
+// tasks watched are never retried.
+func NewRetryTransport(rt http.RoundTripper, retries int, backoff time.Duration, all bool) http.RoundTripper {
+	if retries <= 0 {
+		return rt
+	}
+	return &retryTransport{rt: rt, retries: retries, backoff: backoff, all: all}
+}
+
+// noRetryKey marks the context of a request which is not retried.
+type noRetryKey struct{}
+
+// withoutRetries returns req, sent once by the transport of NewRetryTransport:
+// a stream, which a retry would replay.
+func withoutRetries(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), noRetryKey{}, true))
+}
+
+type retryTransport struct {
+	rt      http.RoundTripper
+	retries int
+	backoff time.Duration
+	all     bool
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.retryable(req) {
+		return t.rt.RoundTrip(req)
+	}
+	for n := 0; ; n++ {
+		r := req
+		if n > 0 && req.Body != nil {
+			// the body of the previous attempt is consumed
+			body, err := resendBody(req)
+			if err != nil {
+				return nil, err
+			}
+			r = req.WithContext(req.Context())
+			r.Body = body
+		}
+		resp, err := t.rt.RoundTrip(r)
+		if n == t.retries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		delay := t.delay(n + 1)
+		fmt.Fprintf(os.Stderr, "Warning: %s %s: %s; retrying in %v (%d/%d)\n",
+			req.Method, req.URL, reason, delay-delay%time.Millisecond, n+1, t.retries)
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable tells whether a request may be sent again: idempotent, or any
+// when all the requests are retried, with a body which can be sent again.
+func (t *retryTransport) retryable(req *http.Request) bool {
+	if req.Context().Value(noRetryKey{}) != nil || !resendable(req) {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return t.all
+}
+
+// delay returns the jittered delay before the nth retry.
+func (t *retryTransport) delay(n int) time.Duration {
+	d := t.backoff
+	for i := 1; i < n && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	retryRand.Lock()
+	defer retryRand.Unlock()
+	return d/2 + time.Duration(retryRand.Int63n(int64(d/2)+1))
+}
+
+// shouldRetry tells whether a request failed for a reason which may go away:
+// a connection refused or reset, e.g. while snap restarts, or an error of the
+// server. The certificates are not checked again.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		cause := err
+		if e, ok := err.(*url.Error); ok {
+			cause = e.Err
+		}
+		return !isCertificateError(err) && cause != context.Canceled && cause != context.DeadlineExceeded
+	}
+	return resp.StatusCode >= 500
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,86 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport, 2, 0, false)}
+
+	tests := []struct {
+		name  string
+		req   func() *http.Request
+		sends int32
+	}{
+		{"GET", func() *http.Request {
+			req, _ := http.NewRequest("GET", srv.URL, nil)
+			return req
+		}, 3},
+		{"POST", func() *http.Request {
+			req, _ := http.NewRequest("POST", srv.URL, nil)
+			return req
+		}, 1},
+		{"stream", func() *http.Request {
+			req, _ := http.NewRequest("GET", srv.URL, nil)
+			return withoutRetries(req)
+		}, 1},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		resp, err := client.Do(tt.req())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if n := atomic.LoadInt32(&requests); n != tt.sends {
+			t.Errorf("%s: sent %d times, want %d", tt.name, n, tt.sends)
+		}
+	}
+}
+
+func TestShouldRetryCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		t.Fatal("expected a certificate error")
+	}
+	if shouldRetry(nil, err) {
+		t.Errorf("shouldRetry(%v) = true, want false", err)
+	}
+
+	srv.Close()
+	_, err = http.DefaultTransport.RoundTrip(req)
+	if !shouldRetry(nil, err) {
+		t.Errorf("shouldRetry(%v) = false, want true", err)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !go1.8
+// +build !go1.8
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"io"
+	"net/http"
+)
+
+// resendable tells whether the body of a request, if any, can be sent again:
+// before Go 1.8, the requests cannot get their body again, so only the ones
+// without a body are.
+func resendable(req *http.Request) bool {
+	return req.Body == nil
+}
+
+// resendBody returns the body of a request to send it again.
+func resendBody(req *http.Request) (io.ReadCloser, error) {
+	return req.Body, nil
+}
@@ -0,0 +1,339 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/intelsdi-x/snap-client-go/client/tasks"
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/robfig/cron"
+	"github.com/urfave/cli"
+)
+
+func previewSchedule(ctx *cli.Context) error {
+	n := ctx.Int("number")
+	if n <= 0 {
+		return newUsageError("The number of runs to preview must be greater than zero", ctx)
+	}
+
+	t, err := scheduleTask(ctx)
+	if err != nil {
+		return err
+	}
+	if err := validateScheduleExists(t.Schedule); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	runs, end, err := nextRuns(t.Schedule, now, n)
+	if err != nil {
+		return err
+	}
+
+	s := t.Schedule
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	printFields(w, false, 0, "Type:", scheduleType(s))
+	if s.Interval != nil && *s.Interval != "" {
+		printFields(w, false, 0, "Interval:", *s.Interval)
+		printFields(w, false, 0, "Description:", describeSchedule(s))
+	}
+	if s.StartTimestamp != nil {
+		printFields(w, false, 0, "Start:", s.StartTimestamp.Format(time.RFC3339))
+	}
+	if s.StopTimestamp != nil {
+		printFields(w, false, 0, "Stop:", s.StopTimestamp.Format(time.RFC3339))
+	}
+	if s.Count > 0 {
+		printFields(w, false, 0, "Count:", s.Count)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if len(runs) == 0 {
+		fmt.Printf("No upcoming run (%s)\n", end)
+		return nil
+	}
+	fmt.Printf("Next %d run(s):\n", len(runs))
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for i, r := range runs {
+		// the runs are to come, rounded to the nearest second
+		d := r.Sub(now) + time.Second/2
+		printFields(w, true, 2, i+1, r.Format("Mon 2006-01-02 15:04:05 MST"), "in "+(d-d%time.Second).String())
+	}
+	w.Flush()
+	if end != "" {
+		fmt.Printf("No further run (%s)\n", end)
+	}
+	return nil
+}
+
+// scheduleTask returns the task whose schedule is previewed: the task manifest
+// (file, "-" or URL) or the existing task given with --task, or a new task built from the schedule
+// flags alone. The schedule flags are merged in the same way as on task creation.
+func scheduleTask(ctx *cli.Context) (*models.Task, error) {
+	ref := ctx.String("task")
+	if ref == "" {
+		if ctx.String("interval") == "" {
+			return nil, newUsageError("Must provide either --task or --interval", ctx)
+		}
+		t := &models.Task{Schedule: &models.Schedule{}}
+		if err := setScheduleFromCliOptions(ctx, t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	if _, err := os.Stat(ref); err == nil || isRemoteManifest(ref) {
+		return readTaskManifest(ctx, ref)
+	}
+
+	params := tasks.NewGetTaskParamsWithTimeout(FlTimeout.Value)
+	params.SetID(ref)
+	resp, err := client.Tasks.GetTask(params, authInfoWriter)
+	if err != nil {
+		return nil, getErrorDetail(err)
+	}
+	t := resp.Payload
+	if err := validateScheduleExists(t.Schedule); err != nil {
+		return nil, err
+	}
+	if err := setScheduleFromCliOptions(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// scheduleType returns the type of a schedule, 'simple' when none is given.
+func scheduleType(s *models.Schedule) string {
+	if s.Type == nil || *s.Type == "" {
+		return "simple"
+	}
+	return *s.Type
+}
+
+// nextRuns returns up to n run times of the schedule after now and, when the
+// schedule ends before that, the reason why.
+func nextRuns(s *models.Schedule, now time.Time, n int) ([]time.Time, string, error) {
+
+	var next func(time.Time) time.Time
+	first := now
+	if s.StartTimestamp != nil && s.StartTimestamp.After(now) {
+		first = *s.StartTimestamp
+	}
+	interval := ""
+	if s.Interval != nil {
+		interval = *s.Interval
+	}
+	switch scheduleType(s) {
+	case "cron":
+		sched, err := cron.Parse(interval)
+		if err != nil {
+			return nil, "", fmt.Errorf("Error: cannot parse cron entry '%v': %v", interval, err)
+		}
+		next = sched.Next
+		// a cron schedule fires at the first matching time of the window
+		first = sched.Next(first.Add(-time.Second))
+	case "simple", "windowed":
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, "", fmt.Errorf("Error: cannot parse interval '%v': %v", interval, err)
+		}
+		if d <= 0 {
+			return nil, "", fmt.Errorf("Error: the interval must be greater than zero")
+		}
+		next = func(t time.Time) time.Time { return t.Add(d) }
+	case "streaming":
+		return nil, "", fmt.Errorf("Error: a 'streaming' schedule has no run times, the metrics are collected as the plugins stream them")
+	default:
+		return nil, "", fmt.Errorf("Error: cannot preview a schedule of type '%v'", scheduleType(s))
+	}
+
+	var runs []time.Time
+	for r := first; len(runs) < n; r = next(r) {
+		if r.IsZero() {
+			return runs, "the cron entry never matches", nil
+		}
+		if s.StopTimestamp != nil && r.After(*s.StopTimestamp) {
+			return runs, "the stop time is reached", nil
+		}
+		if s.Count > 0 && uint64(len(runs)) >= s.Count {
+			return runs, fmt.Sprintf("the count of %d run(s) is reached", s.Count), nil
+		}
+		runs = append(runs, r)
+	}
+	return runs, "", nil
+}
+
+// scheduleSummary is the short form of a schedule shown in the task list,
+// e.g. "cron 0 0 2 * * *" or "streaming".
+func scheduleSummary(s *models.Schedule) string {
+	if s == nil {
+		return ""
+	}
+	if s.Interval == nil || *s.Interval == "" {
+		return scheduleType(s)
+	}
+	return scheduleType(s) + " " + *s.Interval
+}
+
+// describeSchedule explains the interval of a schedule in plain English.
+func describeSchedule(s *models.Schedule) string {
+	if scheduleType(s) == "cron" {
+		return describeCron(*s.Interval)
+	}
+	return "every " + *s.Interval
+}
+
+var (
+	cronDescriptors = map[string]string{
+		"@yearly":   "at 00:00:00 on January 1",
+		"@annually": "at 00:00:00 on January 1",
+		"@monthly":  "at 00:00:00 on the first day of every month",
+		"@weekly":   "at 00:00:00 every Sunday",
+		"@daily":    "at 00:00:00 every day",
+		"@midnight": "at 00:00:00 every day",
+		"@hourly":   "at minute 0 of every hour",
+	}
+	cronMonths   = []string{"", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	cronWeekdays = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+// describeCron turns a cron entry, e.g. "0 */5 9-17 * * MON-FRI", into a
+// description such as "at second 0, every 5 minutes, hours 9 through 17, on
+// weekdays Monday through Friday".
+func describeCron(spec string) string {
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[spec]; ok {
+		return d
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		return "every " + strings.TrimSpace(strings.TrimPrefix(spec, "@every "))
+	}
+
+	f := strings.Fields(spec)
+	if len(f) < 5 || len(f) > 6 {
+		return spec
+	}
+	for len(f) < 6 {
+		f = append(f, "*")
+	}
+	second, minute, hour, dom, month, dow := f[0], f[1], f[2], f[3], f[4], f[5]
+
+	var parts []string
+	if isCronNumber(second) && isCronNumber(minute) && isCronNumber(hour) {
+		h, _ := strconv.Atoi(hour)
+		m, _ := strconv.Atoi(minute)
+		sc, _ := strconv.Atoi(second)
+		parts = append(parts, fmt.Sprintf("at %02d:%02d:%02d", h, m, sc))
+		if isCronAny(dom) && isCronAny(month) && isCronAny(dow) {
+			parts = append(parts, "every day")
+		}
+	} else {
+		for _, p := range [][2]string{{second, "second"}, {minute, "minute"}, {hour, "hour"}} {
+			// "every minute" says nothing more after e.g. "every 5 seconds"
+			if isCronAny(p[0]) && len(parts) > 0 && strings.HasPrefix(parts[len(parts)-1], "every ") {
+				continue
+			}
+			parts = append(parts, describeCronField(p[0], p[1], nil))
+		}
+	}
+	if !isCronAny(dom) {
+		parts = append(parts, "on "+describeCronField(dom, "day", nil)+" of the month")
+	}
+	if !isCronAny(month) {
+		parts = append(parts, "in "+describeCronField(month, "month", cronMonths))
+	}
+	if !isCronAny(dow) {
+		parts = append(parts, "on "+describeCronField(dow, "weekday", cronWeekdays))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeCronField describes one field of a cron entry; names, when given,
+// are used instead of the numbers of the field values.
+func describeCronField(field, unit string, names []string) string {
+	name := func(v string) string {
+		if i, err := strconv.Atoi(v); err == nil && names != nil && i >= 0 && i < len(names) {
+			return names[i]
+		}
+		if names != nil {
+			for _, n := range names {
+				if n != "" && strings.EqualFold(v, n[:3]) {
+					return n
+				}
+			}
+		}
+		return v
+	}
+	if isCronAny(field) {
+		return "every " + unit
+	}
+
+	var items []string
+	for _, item := range strings.Split(field, ",") {
+		step := ""
+		if i := strings.Index(item, "/"); i >= 0 {
+			item, step = item[:i], item[i+1:]
+		}
+		var desc string
+		switch {
+		case isCronAny(item):
+			desc = "every " + step + " " + unit + "s"
+		case strings.Contains(item, "-"):
+			r := strings.SplitN(item, "-", 2)
+			desc = unit + "s " + name(r[0]) + " through " + name(r[1])
+			if step != "" {
+				desc = "every " + step + " " + unit + "s, " + desc
+			}
+		default:
+			if names != nil {
+				desc = name(item)
+			} else {
+				desc = unit + " " + item
+			}
+			if step != "" {
+				desc = "every " + step + " " + unit + "s starting at " + desc
+			}
+		}
+		items = append(items, desc)
+	}
+	if len(items) == 1 {
+		if strings.HasPrefix(items[0], unit+" ") && names == nil && unit != "day" {
+			return "at " + items[0]
+		}
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+func isCronAny(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func isCronNumber(field string) bool {
+	_, err := strconv.Atoi(field)
+	return err == nil
+}
@@ -0,0 +1,351 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// taskManifestSchema is the JSON Schema (draft-04) of task manifests. The
+// workflow of a workflow manifest is checked against its "workflow"
+// definition.
+const taskManifestSchema = `{
+  "$schema": "http://json-schema.org/draft-04/schema#",
+  "id": "https://github.com/intelsdi-x/snap/schema/task-manifest.json",
+  "title": "snap task manifest",
+  "type": "object",
+  "required": ["version", "workflow"],
+  "properties": {
+    "version": {"type": "integer", "enum": [1]},
+    "name": {"type": "string"},
+    "deadline": {"type": "string"},
+    "max-failures": {"type": "integer"},
+    "max-collect-duration": {"type": "string"},
+    "max-metrics-buffer": {"type": "integer", "minimum": 0},
+    "start": {"type": "boolean"},
+    "schedule": {"$ref": "#/definitions/schedule"},
+    "workflow": {"$ref": "#/definitions/workflow"}
+  },
+  "definitions": {
+    "schedule": {
+      "type": "object",
+      "properties": {
+        "type": {"type": "string", "enum": ["simple", "windowed", "cron", "streaming"]},
+        "interval": {"type": ["string", "null"]},
+        "start_timestamp": {"type": "string"},
+        "stop_timestamp": {"type": "string"},
+        "count": {"type": "integer", "minimum": 0}
+      }
+    },
+    "workflow": {
+      "type": "object",
+      "required": ["collect"],
+      "properties": {
+        "collect": {"$ref": "#/definitions/collect"}
+      },
+      "additionalProperties": false
+    },
+    "collect": {
+      "type": "object",
+      "required": ["metrics"],
+      "properties": {
+        "metrics": {"type": "object", "additionalProperties": {"type": "object"}},
+        "config": {"type": "object", "additionalProperties": {"type": "object"}},
+        "tags": {
+          "type": "object",
+          "additionalProperties": {"type": "object", "additionalProperties": {"type": "string"}}
+        },
+        "process": {"type": ["array", "null"], "items": {"$ref": "#/definitions/processor"}},
+        "publish": {"type": ["array", "null"], "items": {"$ref": "#/definitions/publisher"}}
+      },
+      "additionalProperties": false
+    },
+    "processor": {
+      "type": "object",
+      "required": ["plugin_name"],
+      "properties": {
+        "plugin_name": {"type": "string"},
+        "plugin_version": {"type": "integer"},
+        "config": {"type": "object"},
+        "target": {"type": "string"},
+        "process": {"type": ["array", "null"], "items": {"$ref": "#/definitions/processor"}},
+        "publish": {"type": ["array", "null"], "items": {"$ref": "#/definitions/publisher"}}
+      },
+      "additionalProperties": false
+    },
+    "publisher": {
+      "type": "object",
+      "required": ["plugin_name"],
+      "properties": {
+        "plugin_name": {"type": "string"},
+        "plugin_version": {"type": "integer"},
+        "config": {"type": "object"},
+        "target": {"type": "string"}
+      },
+      "additionalProperties": false
+    }
+  }
+}
+`
+
+var manifestSchema map[string]interface{}
+
+func init() {
+	if err := json.Unmarshal([]byte(taskManifestSchema), &manifestSchema); err != nil {
+		panic(fmt.Sprintf("bad task manifest schema: %v", err))
+	}
+}
+
+// schemaViolation is a value of a manifest which does not match the schema.
+type schemaViolation struct {
+	path []interface{}
+	msg  string
+}
+
+// validateSchema checks a JSON document against the task manifest schema, or
+// against one of its definitions when def is not empty, and returns all the
+// violations found.
+func validateSchema(doc interface{}, def string) []schemaViolation {
+	schema := manifestSchema
+	if def != "" {
+		schema = schemaRef("#/definitions/" + def)
+	}
+	var out []schemaViolation
+	checkSchema(doc, schema, nil, &out)
+	return out
+}
+
+func schemaRef(ref string) map[string]interface{} {
+	defs, _ := manifestSchema["definitions"].(map[string]interface{})
+	s, _ := defs[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+	return s
+}
+
+// checkSchema supports the keywords the task manifest schema uses: $ref, type,
+// enum, minimum, required, properties, additionalProperties and items.
+func checkSchema(v interface{}, schema map[string]interface{}, path []interface{}, out *[]schemaViolation) {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = schemaRef(ref)
+	}
+	add := func(p []interface{}, format string, a ...interface{}) {
+		*out = append(*out, schemaViolation{path: p, msg: fmt.Sprintf(format, a...)})
+	}
+	if typ, ok := schema["type"]; ok && !isSchemaType(v, typ) {
+		add(path, "expected %s, got %s", schemaTypeNames(typ), jsonTypeName(v))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		match := false
+		names := make([]string, 0, len(enum))
+		for _, e := range enum {
+			match = match || e == v
+			names = append(names, fmt.Sprint(e))
+		}
+		if !match {
+			add(path, "unexpected value %v (expected %s)", jsonValueString(v), strings.Join(names, ", "))
+		}
+	}
+	if min, ok := schema["minimum"].(float64); ok {
+		if n, ok := v.(float64); ok && n < min {
+			add(path, "%v is lower than the minimum %v", n, min)
+		}
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if req, ok := schema["required"].([]interface{}); ok {
+			for _, r := range req {
+				if _, ok := x[r.(string)]; !ok {
+					add(path, "missing required key '%s'", r)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := append(append([]interface{}{}, path...), k)
+			if s, ok := props[k].(map[string]interface{}); ok {
+				checkSchema(x[k], s, p, out)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					add(p, "unknown key '%s'", k)
+				}
+			case map[string]interface{}:
+				checkSchema(x[k], extra, p, out)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, e := range x {
+				checkSchema(e, items, append(append([]interface{}{}, path...), i), out)
+			}
+		}
+	}
+}
+
+// isSchemaType tells whether v is of the type, or of one of the types, of a
+// schema.
+func isSchemaType(v interface{}, typ interface{}) bool {
+	if l, ok := typ.([]interface{}); ok {
+		for _, t := range l {
+			if isSchemaType(v, t) {
+				return true
+			}
+		}
+		return false
+	}
+	switch typ {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return jsonTypeName(v) == typ
+}
+
+func schemaTypeNames(typ interface{}) string {
+	l, ok := typ.([]interface{})
+	if !ok {
+		return fmt.Sprint(typ)
+	}
+	names := make([]string, 0, len(l))
+	for _, t := range l {
+		names = append(names, fmt.Sprint(t))
+	}
+	return strings.Join(names, " or ")
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonValueString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// checkManifest parses a manifest, in the json or yaml format, and checks it
+// against the task manifest schema, or against one of its definitions when def
+// is not empty. It returns the manifest as JSON, or the errors found located
+// in bts.
+func checkManifest(bts []byte, format, def string) ([]byte, error) {
+	b := bts
+	if format == "yaml" {
+		var err error
+		if b, err = yamlToJSON(bts); err != nil {
+			return nil, err
+		}
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, jsonDecodeError(bts, err)
+	}
+
+	violations := validateSchema(doc, def)
+	if len(violations) == 0 {
+		return b, nil
+	}
+	errs := make(manifestErrors, 0, len(violations))
+	for _, v := range violations {
+		me := &manifestError{path: formatKeyPath(v.path), msg: v.msg}
+		if format == "yaml" {
+			me.line, me.col = yamlKeyPosition(bts, v.path)
+		} else {
+			me.line, me.col = jsonKeyPosition(bts, v.path)
+		}
+		errs = append(errs, me)
+	}
+	return nil, errs
+}
+
+func showManifestSchema(ctx *cli.Context) error {
+	fmt.Print(taskManifestSchema)
+	return nil
+}
+
+func validateManifests(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		return newUsageError("Incorrect usage: at least one manifest is required", ctx)
+	}
+	def := ""
+	if ctx.Bool("workflow") {
+		def = "workflow"
+	}
+	failed := 0
+	for _, path := range ctx.Args() {
+		bts, format, err := readManifest(path, ctx.String("format"))
+		if err != nil {
+			return err
+		}
+		docs := []yamlDocument{{bts: bts, line: 1}}
+		if format == "yaml" {
+			docs = splitYAMLDocuments(bts)
+		}
+		ok := true
+		for _, doc := range docs {
+			if _, err := checkManifest(doc.bts, format, def); err != nil {
+				fmt.Fprintln(os.Stderr, withManifestFile(err, path, doc.line-1))
+				ok = false
+			}
+		}
+		if !ok {
+			failed++
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Error: %d of %d manifest(s) are invalid", failed, len(ctx.Args()))
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/urfave/cli"
+)
+
+// inShell is set while the shell runs, so that it is not started again from
+// within itself.
+var inShell bool
+
+func runShell(ctx *cli.Context) error {
+	if inShell {
+		return fmt.Errorf("Error: already in the snaptel shell")
+	}
+	inShell = true
+	defer func() { inShell = false }()
+
+	app := ctx.App
+	// the client and the credentials set up before this command are kept for
+	// all the commands of the shell, only the config file is applied again
+	before := app.Before
+	app.Before = ApplyConfig
+	defer func() { app.Before = before }()
+	// an extension exiting with an error does not end the shell
+	exiter := cli.OsExiter
+	cli.OsExiter = func(int) {}
+	defer func() { cli.OsExiter = exiter }()
+	// Ctrl-C stops the command handling it, like watch, but not the shell
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer func() {
+		signal.Stop(sig)
+		close(sig)
+	}()
+	go func() {
+		for range sig {
+		}
+	}()
+
+	prompt := "snaptel> "
+	if u, err := url.Parse(FlURL.Value); err == nil && u.Host != "" {
+		prompt = "snaptel " + u.Host + "> "
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		// run the commands piped in, without prompt
+		in := bufio.NewScanner(os.Stdin)
+		for in.Scan() {
+			if quit := runShellLine(app, in.Text()); quit {
+				break
+			}
+		}
+		return in.Err()
+	}
+
+	t := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return completeShellLine(t, app, line, pos)
+	}
+
+	fmt.Println("snaptel shell; type help for the commands, exit or Ctrl-D to leave")
+	for {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		if w, h, err := terminal.GetSize(fd); err == nil && w > 0 {
+			t.SetSize(w, h)
+		}
+		line, err := t.ReadLine()
+		// commands print and prompt on a terminal in its normal mode
+		terminal.Restore(fd, state)
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if quit := runShellLine(app, line); quit {
+			return nil
+		}
+	}
+}
+
+// runShellLine runs a command line of the shell, and tells whether the shell
+// is to be left.
+func runShellLine(app *cli.App, line string) bool {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "exit", "quit":
+		return true
+	}
+	// a timeout set by the defaults of a command, and the global flags of a
+	// line, are for that command only
+	defer func(timeout time.Duration) { FlTimeout.Value = timeout }(FlTimeout.Value)
+	defer func(args []string) { globalFlagArgs = args }(globalFlagArgs)
+	if err := app.Run(append(append([]string{app.Name}, globalFlagArgs...), args...)); err != nil {
+		PrintError(err)
+	}
+	return false
+}
+
+// completeShellLine completes the word before the cursor with the candidates
+// of the completion command: a single candidate replaces the word, several
+// ones are listed after completing their common prefix.
+func completeShellLine(t *terminal.Terminal, app *cli.App, line string, pos int) (string, int, bool) {
+	words, err := splitCommandLine(line[:pos])
+	if err != nil {
+		return "", 0, false
+	}
+	if pos == 0 || line[pos-1] == ' ' {
+		words = append(words, "")
+	}
+	cur := words[len(words)-1]
+	if !strings.HasSuffix(line[:pos], cur) {
+		// quoted or escaped words are left alone
+		return "", 0, false
+	}
+
+	var candidates []string
+	for _, c := range completeWords(app, words) {
+		candidates = append(candidates, strings.SplitN(c, "\t", 2)[0])
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	if completion == cur {
+		fmt.Fprintln(t, strings.Join(candidates, "  "))
+		return "", 0, false
+	}
+	head := line[:pos-len(cur)] + completion
+	return head + line[pos:], len(head), true
+}
+
+// splitCommandLine splits a command line into words like a shell does for
+// blanks, single and double quotes, and backslashes.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word []rune
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			word, escaped = append(word, c), false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word, inWord = append(word, c), true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Error: unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
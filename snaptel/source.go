@@ -0,0 +1,138 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isRemoteManifest tells whether a manifest is read from stdin or a URL
+// rather than from a local file.
+func isRemoteManifest(src string) bool {
+	return src == "-" || strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// readManifest reads a manifest from a local file, from stdin when src is "-"
+// or from an HTTP(S) URL, and returns it with its format, json or yaml. The
+// format is forced with format, or else taken from the file extension, from
+// the content type of the response, or guessed from the content when there is
+// no extension.
+func readManifest(src, format string) ([]byte, string, error) {
+	switch strings.ToLower(format) {
+	case "":
+	case "json":
+		format = "json"
+	case "yaml", "yml":
+		format = "yaml"
+	default:
+		return nil, "", fmt.Errorf("Unsupported manifest format '%s' (expected json or yaml)", format)
+	}
+
+	var bts []byte
+	var contentType string
+	var err error
+	ext := filepath.Ext(src)
+	switch {
+	case src == "-":
+		ext = ""
+		bts, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("Error reading the manifest from stdin: %v", err)
+		}
+	case isRemoteManifest(src):
+		u, err := url.Parse(src)
+		if err != nil {
+			return nil, "", fmt.Errorf("Bad manifest URL '%s': %v", src, err)
+		}
+		ext = path.Ext(u.Path)
+		bts, contentType, err = fetchManifest(src)
+		if err != nil {
+			return nil, "", err
+		}
+	default:
+		bts, err = ioutil.ReadFile(src)
+		if err != nil {
+			return nil, "", fmt.Errorf("File error [%s] - %v", ext, err)
+		}
+	}
+
+	if format != "" {
+		return bts, format, nil
+	}
+	switch ext {
+	case ".yaml", ".yml":
+		return bts, "yaml", nil
+	case ".json":
+		return bts, "json", nil
+	}
+	if ext != "" && !isRemoteManifest(src) {
+		return nil, "", fmt.Errorf("Unsupported file type %s", ext)
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch {
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			return bts, "json", nil
+		case strings.Contains(mt, "yaml"):
+			return bts, "yaml", nil
+		}
+	}
+	return bts, sniffManifestFormat(bts), nil
+}
+
+// fetchManifest downloads a manifest with the TLS settings and the timeout of
+// the API client.
+func fetchManifest(u string) ([]byte, string, error) {
+	c := &http.Client{Timeout: FlTimeout.Value}
+	if httpClient != nil {
+		c.Transport = httpClient.Transport
+	}
+	resp, err := c.Get(u)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error downloading the manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("Error downloading the manifest from %s: %s", u, resp.Status)
+	}
+	bts, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error downloading the manifest: %v", err)
+	}
+	return bts, resp.Header.Get("Content-Type"), nil
+}
+
+// sniffManifestFormat guesses the format of a manifest: JSON documents start
+// with an object or an array, anything else is read as YAML.
+func sniffManifestFormat(bts []byte) string {
+	b := bytes.TrimSpace(bytes.TrimPrefix(bts, []byte("\xef\xbb\xbf")))
+	if len(b) > 0 && (b[0] == '{' || b[0] == '[') {
+		return "json"
+	}
+	return "yaml"
+}
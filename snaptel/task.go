@@ -22,9 +22,7 @@ package snaptel
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -44,9 +42,6 @@ import (
 var (
 	// padding to picking a time to start a "NOW" task
 	createTaskNowPad = time.Second * 1
-	timeParseFormat  = "3:04PM"
-	dateParseFormat  = "1-02-2006"
-	unionParseFormat = timeParseFormat + " " + dateParseFormat
 )
 
 // Constants used to truncate task hit and miss counts
@@ -140,8 +135,9 @@ func stringValToInt(val string) (int, error) {
 func setWindowedSchedule(start *time.Time, stop *time.Time, duration *time.Duration, t *models.Task) error {
 	// if there is an empty schedule already defined for this task, then set the
 	// type for that schedule to 'windowed'
-	if *t.Schedule.Type == "" {
-		*t.Schedule.Type = "windowed"
+	if t.Schedule.Type == nil || *t.Schedule.Type == "" {
+		ty := "windowed"
+		t.Schedule.Type = &ty
 	} else if *t.Schedule.Type != "windowed" {
 		// else if the task's existing schedule is not a 'windowed' schedule,
 		// then return an error
@@ -193,18 +189,43 @@ func setWindowedSchedule(start *time.Time, stop *time.Time, duration *time.Durat
 	return nil
 }
 
+// scheduleTime reads the start or stop of the schedule window either from
+// --start (--stop) or from the --start-time and --start-date pair.
+func scheduleTime(ctx *cli.Context, which string, loc *time.Location) (*time.Time, error) {
+	tm, dt := ctx.String(which+"-time"), ctx.String(which+"-date")
+	if v := ctx.String(which); v != "" {
+		if tm != "" || dt != "" {
+			return nil, newUsageError(fmt.Sprintf("Usage error; --%[1]s cannot be combined with --%[1]s-time or --%[1]s-date", which), ctx)
+		}
+		tm = v
+	}
+	t, err := mergeDateTime(tm, dt, loc)
+	if err != nil {
+		return nil, newUsageError(fmt.Sprintf("Usage error (bad %s date/time); %v", which, err), ctx)
+	}
+	return t, nil
+}
+
 // parse the command-line options and use them to setup a new schedule for this task
 func setScheduleFromCliOptions(ctx *cli.Context, t *models.Task) error {
 	// check the start, stop, and duration values to see if we're looking at a windowed schedule (or not)
 	// first, get the parameters that define the windowed schedule
-	start := mergeDateTime(
-		strings.ToUpper(ctx.String("start-time")),
-		strings.ToUpper(ctx.String("start-date")),
-	)
-	stop := mergeDateTime(
-		strings.ToUpper(ctx.String("stop-time")),
-		strings.ToUpper(ctx.String("stop-date")),
-	)
+	loc := time.Local
+	if tz := ctx.String("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return newUsageError(fmt.Sprintf("Usage error (bad time zone); %v", err), ctx)
+		}
+		loc = l
+	}
+	start, err := scheduleTime(ctx, "start", loc)
+	if err != nil {
+		return err
+	}
+	stop, err := scheduleTime(ctx, "stop", loc)
+	if err != nil {
+		return err
+	}
 	// Grab the duration string (if one was passed in) and parse it
 	durationStr := ctx.String("duration")
 	var duration *time.Duration
@@ -215,6 +236,11 @@ func setScheduleFromCliOptions(ctx *cli.Context, t *models.Task) error {
 		}
 		duration = &d
 	}
+	// a 'streaming' schedule collects the metrics as the plugins stream them, so
+	// it has no interval and no window
+	if ctx.Bool("streaming") || (t.Schedule != nil && scheduleType(t.Schedule) == "streaming") {
+		return setStreamingSchedule(ctx, start != nil || stop != nil || duration != nil, t)
+	}
 	// Grab the interval for the schedule (if one was provided). Note that if an
 	// interval value was not passed in and there is no interval defined for the
 	// schedule associated with this task, it's an error
@@ -227,7 +253,8 @@ func setScheduleFromCliOptions(ctx *cli.Context, t *models.Task) error {
 	isWindowed := (start != nil || stop != nil || duration != nil || (t.Schedule.Type != nil && *(t.Schedule.Type) == "windowed"))
 	// if an interval was passed in, then attempt to parse it (first as a duration,
 	// then as the definition of a cron job)
-	isCron := false
+	// without a new interval, an existing 'cron' schedule stays a 'cron' schedule
+	isCron := interval == "" && t.Schedule.Type != nil && *(t.Schedule.Type) == "cron"
 	if interval != "" {
 		// first try to parse it as a duration
 		_, err := time.ParseDuration(interval)
@@ -258,17 +285,18 @@ func setScheduleFromCliOptions(ctx *cli.Context, t *models.Task) error {
 	// which was set above.
 	if isCron {
 		// make sure the current schedule type (if there is one) matches; if not it is an error
-		if t.Schedule.Type != nil && *(t.Schedule.Type) != "cron" {
-			return fmt.Errorf("Usage error; cannot replace existing schedule of type '%v' with a new, 'cron' schedule", t.Schedule.Type)
+		if t.Schedule.Type != nil && *(t.Schedule.Type) != "" && *(t.Schedule.Type) != "cron" {
+			return fmt.Errorf("Usage error; cannot replace existing schedule of type '%v' with a new, 'cron' schedule", *t.Schedule.Type)
 		}
-		*t.Schedule.Type = "cron"
+		ty := "cron"
+		t.Schedule.Type = &ty
 		return nil
 	}
 	// if it wasn't a 'windowed' schedule and it's not a 'cron' schedule, then it must be a 'simple'
 	// schedule, so first make sure the current schedule type (if there is one) matches; if not
 	// then it's an error
-	if t.Schedule.Type != nil && *(t.Schedule.Type) != "simple" {
-		return fmt.Errorf("Usage error; cannot replace existing schedule of type '%v' with a new, 'simple' schedule", t.Schedule.Type)
+	if t.Schedule.Type != nil && *(t.Schedule.Type) != "" && *(t.Schedule.Type) != "simple" {
+		return fmt.Errorf("Usage error; cannot replace existing schedule of type '%v' with a new, 'simple' schedule", *t.Schedule.Type)
 	}
 
 	countValStr := ctx.String("count")
@@ -288,6 +316,28 @@ func setScheduleFromCliOptions(ctx *cli.Context, t *models.Task) error {
 	return nil
 }
 
+// setStreamingSchedule turns the schedule of the task into a 'streaming' schedule.
+func setStreamingSchedule(ctx *cli.Context, windowed bool, t *models.Task) error {
+	if t.Schedule == nil {
+		t.Schedule = &models.Schedule{}
+	}
+	if ty := scheduleType(t.Schedule); t.Schedule.Type != nil && *t.Schedule.Type != "" && ty != "streaming" {
+		return fmt.Errorf("Usage error; cannot replace existing schedule of type '%v' with a new, 'streaming' schedule", ty)
+	}
+	if ctx.String("interval") != "" {
+		return fmt.Errorf("Usage error; a 'streaming' schedule does not take an interval")
+	}
+	if windowed {
+		return fmt.Errorf("Usage error; a 'streaming' schedule cannot be given a start, stop or duration")
+	}
+	if ctx.String("count") != "" {
+		return fmt.Errorf("Usage error; a 'streaming' schedule does not take a count")
+	}
+	ty := "streaming"
+	t.Schedule.Type = &ty
+	return nil
+}
+
 // stringValToUint64 parses the input (string) as an unsigned integer value (and returns that uint value
 // to the caller or an error if the input value cannot be parsed as an unsigned integer)
 func stringValToUint64(val string) (uint64, error) {
@@ -327,18 +377,37 @@ func mergeCliOptions(ctx *cli.Context, t *models.Task) error {
 		}
 		t.MaxFailures = int64(maxFailures)
 	}
+	// set the collection limits of a streaming task (if provided in the CLI options)
+	maxCollectDuration := ctx.String("max-collect-duration")
+	if ctx.IsSet("max-collect-duration") || maxCollectDuration != "" {
+		if _, err := time.ParseDuration(maxCollectDuration); err != nil {
+			return fmt.Errorf("Usage error (bad max-collect-duration format); %v", err)
+		}
+		t.MaxCollectDuration = maxCollectDuration
+	}
+	maxMetricsBufferStrVal := ctx.String("max-metrics-buffer")
+	if ctx.IsSet("max-metrics-buffer") || maxMetricsBufferStrVal != "" {
+		maxMetricsBuffer, err := stringValToInt(maxMetricsBufferStrVal)
+		if err != nil {
+			return err
+		}
+		t.MaxMetricsBuffer = int64(maxMetricsBuffer)
+	}
 	// set the schedule for the task from the CLI options (and return the results
 	// of that method call, indicating whether or not an error was encountered while
 	// setting up that schedule)
 	return setScheduleFromCliOptions(ctx, t)
 }
 
+// convert turns the maps decoded by yaml.v2 into maps with string keys, so that
+// they can be marshalled to JSON; numeric and boolean keys, e.g. a config key
+// named 1 or yes, are turned into their string form.
 func convert(i interface{}) interface{} {
 	switch x := i.(type) {
 	case map[interface{}]interface{}:
 		m2i := map[string]interface{}{}
 		for k, v := range x {
-			m2i[k.(string)] = convert(v)
+			m2i[fmt.Sprint(k)] = convert(v)
 		}
 		return m2i
 	case []interface{}:
@@ -349,84 +418,180 @@ func convert(i interface{}) interface{} {
 	return i
 }
 
-func createTaskUsingTaskManifest(ctx *cli.Context) error {
-	// get the task manifest file to use
-	path := ctx.String("task-manifest")
-	ext := filepath.Ext(path)
-	file, e := ioutil.ReadFile(path)
-	if e != nil {
-		return fmt.Errorf("File error [%s] - %v", ext, e)
+// readTaskManifest reads the task manifest at path, "-" for stdin or an
+// HTTP(S) URL, and merges the CLI options into it.
+func readTaskManifest(ctx *cli.Context, path string) (*models.Task, error) {
+	tsks, err := readTaskManifests(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tsks) != 1 {
+		return nil, fmt.Errorf("Error: %s holds %d task manifests, expected a single one", path, len(tsks))
+	}
+	return tsks[0], nil
+}
+
+// readTaskManifests reads the task manifests at path, a YAML file holding one
+// task per document, and merges the CLI options into each of them. All the
+// documents are validated, the error of the first invalid one is returned.
+func readTaskManifests(ctx *cli.Context, path string) ([]*models.Task, error) {
+	file, format, err := readManifest(path, ctx.String("format"))
+	if err != nil {
+		return nil, err
 	}
 
 	bts := []byte(os.ExpandEnv(string(file)))
 
-	var tsk *models.Task
-	switch ext {
-	case ".yaml", ".yml":
-		t, err := taskYamlToJSON(ctx, bts)
+	if format != "yaml" {
+		t, err := taskJSONToJSON(ctx, bts)
 		if err != nil {
-			return err
+			return nil, withManifestFile(err, path, 0)
 		}
-		tsk = t
-	case ".json":
-		t, err := taskJSONToJSON(ctx, bts)
+		return []*models.Task{t}, nil
+	}
+
+	docs := splitYAMLDocuments(bts)
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("Error: %s holds no task manifest", path)
+	}
+	tsks := make([]*models.Task, 0, len(docs))
+	for i, doc := range docs {
+		t, err := taskYamlToJSON(ctx, doc.bts)
 		if err != nil {
-			return err
+			switch err.(type) {
+			case *manifestError, manifestErrors:
+				// located in the file, which tells the document
+				return nil, withManifestFile(err, path, doc.line-1)
+			}
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("Document %d: %v", i+1, err)
+			}
+			return nil, err
 		}
-		tsk = t
-	default:
-		return fmt.Errorf("Unsupported file type %s", ext)
+		tsks = append(tsks, t)
 	}
+	return tsks, nil
+}
 
-	// Request parameters
-	params := tasks.NewAddTaskParamsWithTimeout(FlTimeout.Value)
-	params.SetTask(tsk)
+// yamlDocument is a document of a YAML stream and the line it starts at.
+type yamlDocument struct {
+	bts  []byte
+	line int
+}
 
-	resp, err := client.Tasks.AddTask(params, authInfoWriter)
+// splitYAMLDocuments splits a YAML stream at its "---" document separators,
+// leaving out the documents which only hold comments or blank lines.
+func splitYAMLDocuments(bts []byte) []yamlDocument {
+	var docs []yamlDocument
+	var cur []string
+	start := 1
+	empty := true
+	flush := func() {
+		if !empty {
+			// ended by a newline like the last one, so that the errors
+			// at its end are on the right line
+			docs = append(docs, yamlDocument{bts: []byte(strings.Join(cur, "\n") + "\n"), line: start})
+		}
+		cur, empty = nil, true
+	}
+	for n, line := range strings.Split(string(bts), "\n") {
+		if line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t") || line == "..." {
+			flush()
+			start = n + 2
+			// a document may start on the separator line, e.g. "--- !!map"
+			if rest := strings.TrimSpace(strings.TrimPrefix(line, "---")); rest != "" && rest != "..." && !strings.HasPrefix(rest, "#") {
+				cur, empty, start = append(cur, rest), false, n+1
+			}
+			continue
+		}
+		cur = append(cur, line)
+		if t := strings.TrimSpace(line); t != "" && !strings.HasPrefix(t, "#") {
+			empty = false
+		}
+	}
+	flush()
+	return docs
+}
+
+func createTaskUsingTaskManifest(ctx *cli.Context) error {
+	// get the task manifest file to use
+	tsks, err := readTaskManifests(ctx, ctx.String("task-manifest"))
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return err
 	}
 
-	res := resp.Payload
-	fmt.Println("Task created")
-	fmt.Printf("ID: %s\n", res.ID)
-	fmt.Printf("Name: %s\n", res.Name)
-	fmt.Printf("State: %s\n", res.TaskState)
+	var created []string
+	for i, tsk := range tsks {
+		// Request parameters
+		params := tasks.NewAddTaskParamsWithTimeout(FlTimeout.Value)
+		params.SetTask(tsk)
+
+		resp, err := client.Tasks.AddTask(params, authInfoWriter)
+		if err != nil {
+			err = getErrorDetail(err)
+			if len(tsks) == 1 {
+				return err
+			}
+			fmt.Printf("Task %d/%d failed\n", i+1, len(tsks))
+			if ctx.Bool("rollback") {
+				rollbackTasks(created)
+			}
+			return err
+		}
+
+		res := resp.Payload
+		created = append(created, res.ID)
+		if len(tsks) == 1 {
+			fmt.Println("Task created")
+		} else {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Task %d/%d created\n", i+1, len(tsks))
+		}
+		fmt.Printf("ID: %s\n", res.ID)
+		fmt.Printf("Name: %s\n", res.Name)
+		fmt.Printf("State: %s\n", res.TaskState)
+	}
 
 	return nil
 }
 
+// rollbackTasks stops and removes the tasks created before a failure, the
+// latest first.
+func rollbackTasks(ids []string) {
+	for i := len(ids) - 1; i >= 0; i-- {
+		// a running task has to be stopped before its removal
+		updateTaskState(ids[i], "stop")
+		if err := removeTaskByID(ids[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing task %s: %s\n", ids[i], apiErrorMessage(err))
+			continue
+		}
+		fmt.Printf("Rolled back task %s\n", ids[i])
+	}
+}
+
 func createTaskUsingWFManifest(ctx *cli.Context) error {
 	// Get the workflow manifest filename from the command-line
-	path := ctx.String("workflow-manifest")
-	ext := filepath.Ext(path)
-	file, e := ioutil.ReadFile(path)
-	if e != nil {
-		return fmt.Errorf("File error [%s] - %v", ext, e)
+	file, format, err := readManifest(ctx.String("workflow-manifest"), ctx.String("format"))
+	if err != nil {
+		return err
 	}
 
 	// check to make sure that an interval was specified using the appropriate command-line flag
 	interval := ctx.String("interval")
-	if !ctx.IsSet("interval") || interval == "" {
-		return fmt.Errorf("Workflow manifest requires that an interval be set via a command-line flag")
+	if (!ctx.IsSet("interval") || interval == "") && !ctx.Bool("streaming") {
+		return fmt.Errorf("Workflow manifest requires that an interval (or --streaming) be set via a command-line flag")
 	}
 
 	var tsk *models.Task
-	switch ext {
-	case ".yaml", ".yml":
-		t, err := wfYamlToJSON(ctx, file)
-		if err != nil {
-			return err
-		}
-		tsk = t
-	case ".json":
-		t, err := wfJSONtoJSON(ctx, file)
-		if err != nil {
-			return err
-		}
-		tsk = t
-	default:
-		return fmt.Errorf("Unsupported file type %s", ext)
+	if format == "yaml" {
+		tsk, err = wfYamlToJSON(ctx, file)
+	} else {
+		tsk, err = wfJSONtoJSON(ctx, file)
+	}
+	if err != nil {
+		return withManifestFile(err, ctx.String("workflow-manifest"), 0)
 	}
 
 	params := tasks.NewAddTaskParamsWithTimeout(FlTimeout.Value)
@@ -434,7 +599,7 @@ func createTaskUsingWFManifest(ctx *cli.Context) error {
 
 	resp, err := client.Tasks.AddTask(params, authInfoWriter)
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return getErrorDetail(err)
 	}
 	res := resp.Payload
 	fmt.Println("Task created")
@@ -445,47 +610,31 @@ func createTaskUsingWFManifest(ctx *cli.Context) error {
 	return nil
 }
 
-func mergeDateTime(tm, dt string) *time.Time {
-	reTm := time.Now().Add(createTaskNowPad)
-	if dt == "" && tm == "" {
-		return nil
-	}
-	if dt != "" {
-		t, err := time.Parse(dateParseFormat, dt)
-		if err != nil {
-			fmt.Printf("Error creating task:\n%v\n", err)
-			os.Exit(1)
-		}
-		reTm = t
-	}
-
-	if tm != "" {
-		_, err := time.ParseInLocation(timeParseFormat, tm, time.Local)
-		if err != nil {
-			fmt.Printf("Error creating task:\n%v\n", err)
-			os.Exit(1)
-		}
-		reTm, err = time.ParseInLocation(unionParseFormat, fmt.Sprintf("%s %s", tm, reTm.Format(dateParseFormat)), time.Local)
-		if err != nil {
-			fmt.Printf("Error creating task:\n%v\n", err)
-			os.Exit(1)
-		}
+// fetchTasks returns all the tasks of the snap daemon.
+func fetchTasks() ([]*models.Task, error) {
+	params := tasks.NewGetTasksParamsWithTimeout(FlTimeout.Value)
+	resp, err := client.Tasks.GetTasks(params, authInfoWriter)
+	if err != nil {
+		return nil, err
 	}
-	return &reTm
+	return resp.Payload.Tasks, nil
 }
 
 func listTask(ctx *cli.Context) error {
-	params := tasks.NewGetTasksParamsWithTimeout(FlTimeout.Value)
-	resp, err := client.Tasks.GetTasks(params, authInfoWriter)
+	if ctx.Bool("watch") {
+		return watchTaskList(ctx)
+	}
+
+	tsks, err := fetchTasks()
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return getErrorDetail(err)
 	}
 
 	termWidth, _, _ := terminal.GetSize(int(os.Stdout.Fd()))
 	verbose := ctx.Bool("verbose")
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-	if len(resp.Payload.Tasks) == 0 {
+	if len(tsks) == 0 {
 		fmt.Println("No task found. Have you created a task?")
 		return nil
 	}
@@ -496,13 +645,14 @@ func listTask(ctx *cli.Context) error {
 		"HIT",
 		"MISS",
 		"FAIL",
+		"SCHEDULE",
 		"CREATED",
 		"LAST FAILURE",
 	)
-	for _, task := range resp.Payload.Tasks {
-		//165 is the width of the error message from ID - LAST FAILURE inclusive.
+	for _, task := range tsks {
+		//189 is the width of the error message from ID - LAST FAILURE inclusive.
 		//If the header row wraps, then the error message will automatically wrap too
-		if termWidth < 165 {
+		if termWidth < 189 {
 			verbose = true
 		}
 		printFields(w, false, 0,
@@ -512,9 +662,10 @@ func listTask(ctx *cli.Context) error {
 			trunc(int(task.HitCount)),
 			trunc(int(task.MissCount)),
 			trunc(int(task.FailedCount)),
+			fixSize(verbose, scheduleSummary(task.Schedule), 23),
 			time.Unix(task.CreationTimestamp, 0).Format(time.RFC1123),
-			/*153 is the width of the error message from ID up to LAST FAILURE*/
-			fixSize(verbose, task.LastFailureMessage, termWidth-153),
+			/*177 is the width of the error message from ID up to LAST FAILURE*/
+			fixSize(verbose, task.LastFailureMessage, termWidth-177),
 		)
 	}
 	w.Flush()
@@ -533,6 +684,24 @@ func fixSize(verbose bool, msg string, width int) string {
 	return msg
 }
 
+// updateTaskState applies the given action (start, stop or enable) to a task.
+func updateTaskState(id, action string) error {
+	params := tasks.NewUpdateTaskStateParamsWithTimeout(FlTimeout.Value)
+	params.SetID(id)
+	params.SetAction(action)
+
+	_, err := client.Tasks.UpdateTaskState(params, authInfoWriter)
+	return err
+}
+
+func removeTaskByID(id string) error {
+	params := tasks.NewRemoveTaskParamsWithTimeout(FlTimeout.Value)
+	params.SetID(id)
+
+	_, err := client.Tasks.RemoveTask(params, authInfoWriter)
+	return err
+}
+
 func startTask(ctx *cli.Context) error {
 	if len(ctx.Args()) != 1 {
 		return newUsageError("Incorrect usage", ctx)
@@ -540,13 +709,8 @@ func startTask(ctx *cli.Context) error {
 
 	id := ctx.Args().First()
 
-	params := tasks.NewUpdateTaskStateParamsWithTimeout(FlTimeout.Value)
-	params.SetID(id)
-	params.SetAction("start")
-
-	_, err := client.Tasks.UpdateTaskState(params, authInfoWriter)
-	if err != nil {
-		return getErrorDetail(err, ctx)
+	if err := updateTaskState(id, "start"); err != nil {
+		return getErrorDetail(err)
 	}
 
 	fmt.Println("Task started:")
@@ -562,13 +726,8 @@ func stopTask(ctx *cli.Context) error {
 
 	id := ctx.Args().First()
 
-	params := tasks.NewUpdateTaskStateParamsWithTimeout(FlTimeout.Value)
-	params.SetID(id)
-	params.SetAction("stop")
-
-	_, err := client.Tasks.UpdateTaskState(params, authInfoWriter)
-	if err != nil {
-		return getErrorDetail(err, ctx)
+	if err := updateTaskState(id, "stop"); err != nil {
+		return getErrorDetail(err)
 	}
 
 	fmt.Println("Task stopped:")
@@ -584,12 +743,8 @@ func removeTask(ctx *cli.Context) error {
 
 	id := ctx.Args().First()
 
-	params := tasks.NewRemoveTaskParamsWithTimeout(FlTimeout.Value)
-	params.SetID(id)
-
-	_, err := client.Tasks.RemoveTask(params, authInfoWriter)
-	if err != nil {
-		return getErrorDetail(err, ctx)
+	if err := removeTaskByID(id); err != nil {
+		return getErrorDetail(err)
 	}
 
 	fmt.Println("Task removed:")
@@ -605,13 +760,8 @@ func enableTask(ctx *cli.Context) error {
 
 	id := ctx.Args().First()
 
-	params := tasks.NewUpdateTaskStateParamsWithTimeout(FlTimeout.Value)
-	params.SetID(id)
-	params.SetAction("enable")
-
-	_, err := client.Tasks.UpdateTaskState(params, authInfoWriter)
-	if err != nil {
-		return getErrorDetail(err, ctx)
+	if err := updateTaskState(id, "enable"); err != nil {
+		return getErrorDetail(err)
 	}
 
 	fmt.Println("Task enabled:")
@@ -629,7 +779,7 @@ func exportTask(ctx *cli.Context) error {
 
 	resp, err := client.Tasks.GetTask(params, authInfoWriter)
 	if err != nil {
-		return getErrorDetail(err, ctx)
+		return getErrorDetail(err)
 	}
 
 	tb, err := json.Marshal(resp.Payload)
@@ -667,6 +817,9 @@ func validateTask(t *models.Task) error {
 	if t.Version != 1 {
 		return fmt.Errorf("Error: Invalid version provided for task manifest")
 	}
+	if (t.MaxCollectDuration != "" || t.MaxMetricsBuffer != 0) && scheduleType(t.Schedule) != "streaming" {
+		return fmt.Errorf("Error: max-collect-duration and max-metrics-buffer only apply to a 'streaming' schedule")
+	}
 	return nil
 }
 
@@ -677,11 +830,24 @@ func validateScheduleExists(schedule *models.Schedule) error {
 	if *schedule == (models.Schedule{}) {
 		return fmt.Errorf("Error: Task manifest included an empty schedule. Task manifests need to include a schedule")
 	}
+	hasInterval := schedule.Interval != nil && *schedule.Interval != ""
+	switch ty := scheduleType(schedule); ty {
+	case "streaming":
+		if hasInterval {
+			return fmt.Errorf("Error: Task manifest included an interval for a 'streaming' schedule, which collects metrics as they are streamed")
+		}
+	case "simple", "windowed", "cron":
+		if !hasInterval {
+			return fmt.Errorf("Error: Task manifest did not include an interval for its '%v' schedule", ty)
+		}
+	default:
+		return fmt.Errorf("Error: Task manifest included a schedule of unknown type '%v' (expected simple, windowed, cron or streaming)", ty)
+	}
 	return nil
 }
 
 func wfYamlToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
-	b, err := yamlToJSON(bts)
+	b, err := checkManifest(bts, "yaml", "workflow")
 	if err != nil {
 		return nil, err
 	}
@@ -701,7 +867,7 @@ func wfYamlToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
 }
 
 func taskYamlToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
-	b, err := yamlToJSON(bts)
+	b, err := checkManifest(bts, "yaml", "")
 	if err != nil {
 		return nil, err
 	}
@@ -709,6 +875,11 @@ func taskYamlToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
 	t := models.Task{}
 	err = json.Unmarshal(b, &t)
 	if err != nil {
+		// the offsets of the converted JSON mean nothing in the YAML file
+		if me, ok := jsonDecodeError(b, err).(*manifestError); ok && me.path != "" {
+			me.line, me.col = yamlKeyPosition(bts, splitKeyPath(me.path))
+			return nil, me
+		}
 		return nil, fmt.Errorf("Error parsing JSON file: %v", err)
 	}
 	return toTaskJSON(ctx, t)
@@ -717,7 +888,7 @@ func taskYamlToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
 func yamlToJSON(bts []byte) ([]byte, error) {
 	var body interface{}
 	if err := yaml.Unmarshal(bts, &body); err != nil {
-		return nil, fmt.Errorf("Unmarshal YMAL file error: %v", err)
+		return nil, yamlSyntaxError(err)
 	}
 
 	body = convert(body)
@@ -743,19 +914,25 @@ func toTaskJSON(ctx *cli.Context, t models.Task) (*models.Task, error) {
 }
 
 func taskJSONToJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
+	if _, err := checkManifest(bts, "json", ""); err != nil {
+		return nil, err
+	}
 	t := models.Task{}
 
 	if err := json.Unmarshal(bts, &t); err != nil {
-		return nil, fmt.Errorf("Error parsing JSON file: %v", err)
+		return nil, jsonDecodeError(bts, err)
 	}
 	return toTaskJSON(ctx, t)
 }
 
 func wfJSONtoJSON(ctx *cli.Context, bts []byte) (*models.Task, error) {
+	if _, err := checkManifest(bts, "json", "workflow"); err != nil {
+		return nil, err
+	}
 	wf := models.WorkflowMap{}
 	err := json.Unmarshal(bts, &wf)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing Workflow JSON file: %v", err)
+		return nil, jsonDecodeError(bts, err)
 	}
 
 	t := models.Task{
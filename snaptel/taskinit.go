@@ -0,0 +1,362 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+// initPlugin is a processor or publisher of the scaffolded workflow.
+type initPlugin struct {
+	name    string
+	version int64
+}
+
+func initTask(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		return newUsageError("Incorrect usage: at most one output file is allowed", ctx)
+	}
+	out := ctx.Args().First()
+	if out != "" && !ctx.Bool("force") {
+		if _, err := os.Stat(out); err == nil {
+			return fmt.Errorf("Error: %s already exists; use --force to overwrite it", out)
+		}
+	}
+	interval := ctx.String("interval")
+	if interval == "" {
+		interval = "1s"
+	}
+	if _, err := time.ParseDuration(interval); err != nil {
+		return newUsageError(fmt.Sprintf("Usage error (bad interval value); %v", err), ctx)
+	}
+
+	metrics, err := queryMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	plugins, err := fetchPlugins(false)
+	if err != nil {
+		return getErrorDetail(err)
+	}
+
+	interactive := terminal.IsTerminal(int(os.Stdin.Fd()))
+	in := bufio.NewReader(os.Stdin)
+
+	globs := ctx.StringSlice("metric")
+	var selected []*models.Metric
+	if len(globs) > 0 {
+		selected, err = matchMetrics(latestMetrics(metrics), globs)
+	} else if interactive {
+		selected, err = promptMetrics(in, latestMetrics(metrics))
+	} else {
+		return newUsageError("Must provide at least one --metric when not run from a terminal", ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	processors, err := initPlugins(ctx, in, plugins, "processor", interactive && len(globs) == 0)
+	if err != nil {
+		return err
+	}
+	publishers, err := initPlugins(ctx, in, plugins, "publisher", interactive && len(globs) == 0)
+	if err != nil {
+		return err
+	}
+
+	doc, missing := taskManifest(ctx.String("name"), interval, selected, processors, publishers)
+	bts, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		os.Stdout.Write(bts)
+	} else {
+		if err := ioutil.WriteFile(out, bts, 0644); err != nil {
+			return fmt.Errorf("Error writing %s: %v", out, err)
+		}
+		fmt.Printf("Task manifest written to %s\n", out)
+	}
+	for _, m := range missing {
+		fmt.Fprintf(os.Stderr, "Fill in the required config value %s\n", m)
+	}
+	return nil
+}
+
+// latestMetrics keeps the latest version of every metric, sorted by namespace.
+func latestMetrics(metrics []*models.Metric) []*models.Metric {
+	latest := map[string]*models.Metric{}
+	for _, m := range metrics {
+		if l, ok := latest[*m.Namespace]; !ok || m.Version > l.Version {
+			latest[*m.Namespace] = m
+		}
+	}
+	var keys []string
+	for k := range latest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*models.Metric, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, latest[k])
+	}
+	return out
+}
+
+// matchMetrics returns the metrics whose namespace matches one of the globs.
+func matchMetrics(metrics []*models.Metric, globs []string) ([]*models.Metric, error) {
+	var out []*models.Metric
+	for _, g := range globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("Error: bad namespace glob '%s': %v", g, err)
+		}
+	}
+	for _, m := range metrics {
+		for _, g := range globs {
+			if ok, _ := path.Match(g, *m.Namespace); ok {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("No metric matches %s", strings.Join(globs, ", "))
+	}
+	return out, nil
+}
+
+// promptMetrics lists the metric catalog and asks which metrics to collect. The
+// prompts go to stderr, the manifest being written to stdout without a file.
+func promptMetrics(in *bufio.Reader, metrics []*models.Metric) ([]*models.Metric, error) {
+	fmt.Fprintln(os.Stderr, "Metrics:")
+	for i, m := range metrics {
+		fmt.Fprintf(os.Stderr, "  %3d  %s\n", i+1, *m.Namespace)
+	}
+	for {
+		answer, err := prompt(in, "Metrics to collect (e.g. 1,3-5, a namespace glob or all): ")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			continue
+		}
+		if answer == "all" {
+			return metrics, nil
+		}
+		if strings.HasPrefix(answer, "/") {
+			sel, err := matchMetrics(metrics, strings.Fields(answer))
+			if err == nil {
+				return sel, nil
+			}
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		idx, err := parseSelection(answer, len(metrics))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		var sel []*models.Metric
+		for _, i := range idx {
+			sel = append(sel, metrics[i])
+		}
+		return sel, nil
+	}
+}
+
+// initPlugins returns the plugins of the given type which are given with the
+// --processor or --publisher flag, or which are picked interactively.
+func initPlugins(ctx *cli.Context, in *bufio.Reader, loaded []*models.Plugin, typ string, ask bool) ([]initPlugin, error) {
+	var candidates []*models.Plugin
+	for _, p := range loaded {
+		if p.Type == typ {
+			candidates = append(candidates, p)
+		}
+	}
+
+	var out []initPlugin
+	for _, v := range ctx.StringSlice(typ) {
+		p := initPlugin{name: v}
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			ver, err := strconv.ParseInt(v[i+1:], 10, 64)
+			if err != nil {
+				return nil, newUsageError(fmt.Sprintf("Bad %s '%s', expected <name>[:<version>]", typ, v), ctx)
+			}
+			p = initPlugin{name: v[:i], version: ver}
+		}
+		if !hasPlugin(candidates, p) {
+			return nil, fmt.Errorf("Error: %s %s is not loaded", typ, v)
+		}
+		out = append(out, p)
+	}
+	if len(out) > 0 || !ask || len(candidates) == 0 {
+		return out, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Loaded %ss:\n", typ)
+	for i, p := range candidates {
+		fmt.Fprintf(os.Stderr, "  %3d  %s (version %d)\n", i+1, p.Name, p.Version)
+	}
+	for {
+		answer, err := prompt(in, fmt.Sprintf("%ss to use, in order (e.g. 1,2 or empty for none): ", strings.Title(typ)))
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return nil, nil
+		}
+		idx, err := parseSelection(answer, len(candidates))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		for _, i := range idx {
+			out = append(out, initPlugin{name: candidates[i].Name, version: candidates[i].Version})
+		}
+		return out, nil
+	}
+}
+
+func hasPlugin(plugins []*models.Plugin, p initPlugin) bool {
+	for _, l := range plugins {
+		if l.Name == p.name && (p.version == 0 || l.Version == p.version) {
+			return true
+		}
+	}
+	return false
+}
+
+func prompt(in *bufio.Reader, question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := in.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("Error reading the answer: %v", err)
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// parseSelection parses a list of 1-based indexes and ranges, e.g. "1,3-5",
+// into 0-based indexes lower than n.
+func parseSelection(s string, n int) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || from < 1 || to > n || from > to {
+			return nil, fmt.Errorf("Bad selection '%s', expected numbers between 1 and %d", part, n)
+		}
+		for i := from; i <= to; i++ {
+			out = append(out, i-1)
+		}
+	}
+	return out, nil
+}
+
+// taskManifest builds the task manifest. Every metric gets the config keys of
+// its policy which have a default, and a placeholder for the required ones
+// without a default; these are returned so that the user can fill them in.
+func taskManifest(name, interval string, metrics []*models.Metric, processors, publishers []initPlugin) (yaml.MapSlice, []string) {
+	var missing []string
+	metricsMap := yaml.MapSlice{}
+	config := yaml.MapSlice{}
+	for _, m := range metrics {
+		metricsMap = append(metricsMap, yaml.MapItem{Key: *m.Namespace, Value: yaml.MapSlice{}})
+		var keys yaml.MapSlice
+		for _, rule := range m.Policy {
+			switch {
+			case rule.Default != nil:
+				keys = append(keys, yaml.MapItem{Key: rule.Name, Value: rule.Default})
+			case rule.Required:
+				keys = append(keys, yaml.MapItem{Key: rule.Name, Value: fmt.Sprintf("<required %s>", rule.Type)})
+				missing = append(missing, *m.Namespace+": "+rule.Name)
+			}
+		}
+		if len(keys) > 0 {
+			config = append(config, yaml.MapItem{Key: *m.Namespace, Value: keys})
+		}
+	}
+
+	collect := yaml.MapSlice{{Key: "metrics", Value: metricsMap}}
+	if len(config) > 0 {
+		collect = append(collect, yaml.MapItem{Key: "config", Value: config})
+	}
+
+	var publish []interface{}
+	for _, p := range publishers {
+		publish = append(publish, pluginNode(p))
+	}
+	// processors are chained, the publishers being the last step
+	var next yaml.MapItem
+	if len(publish) > 0 {
+		next = yaml.MapItem{Key: "publish", Value: publish}
+	}
+	for i := len(processors) - 1; i >= 0; i-- {
+		node := pluginNode(processors[i])
+		if next.Key != nil {
+			node = append(node, next)
+		}
+		next = yaml.MapItem{Key: "process", Value: []interface{}{node}}
+	}
+	if next.Key != nil {
+		collect = append(collect, next)
+	}
+
+	doc := yaml.MapSlice{
+		{Key: "version", Value: 1},
+		{Key: "schedule", Value: yaml.MapSlice{
+			{Key: "type", Value: "simple"},
+			{Key: "interval", Value: interval},
+		}},
+	}
+	if name != "" {
+		doc = append(doc, yaml.MapItem{Key: "name", Value: name})
+	}
+	doc = append(doc, yaml.MapItem{Key: "workflow", Value: yaml.MapSlice{{Key: "collect", Value: collect}}})
+	return doc, missing
+}
+
+func pluginNode(p initPlugin) yaml.MapSlice {
+	node := yaml.MapSlice{{Key: "plugin_name", Value: p.name}}
+	if p.version > 0 {
+		node = append(node, yaml.MapItem{Key: "plugin_version", Value: p.version})
+	}
+	return node
+}
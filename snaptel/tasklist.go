@@ -0,0 +1,255 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+// ANSI escape sequences used to redraw the screen in place
+const (
+	ansiAltScreenOn  = "\033[?1049h"
+	ansiAltScreenOff = "\033[?1049l"
+	ansiHideCursor   = "\033[?25l"
+	ansiShowCursor   = "\033[?25h"
+	ansiHome         = "\033[H"
+	ansiClearLine    = "\033[K"
+	ansiClearBelow   = "\033[J"
+	ansiReset        = "\033[0m"
+	ansiBold         = "\033[1m"
+	ansiRed          = "\033[31m"
+	ansiYellow       = "\033[33m"
+)
+
+// taskCounters is the state of a task at the previous refresh.
+type taskCounters struct {
+	state  string
+	hit    int64
+	miss   int64
+	failed int64
+}
+
+// taskListView keeps what is needed to redraw the watched task list.
+type taskListView struct {
+	interval time.Duration
+	tasks    []*models.Task
+	prev     map[string]taskCounters
+	deltas   map[string]taskCounters
+	err      error
+	updated  time.Time
+}
+
+func watchTaskList(ctx *cli.Context) error {
+	interval := ctx.Duration("interval")
+	if interval <= 0 {
+		return newUsageError("The refresh interval must be greater than zero", ctx)
+	}
+
+	v := &taskListView{interval: interval}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiAltScreenOff)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	v.refresh()
+	for {
+		fmt.Print(v.render())
+		select {
+		case <-ticker.C:
+			v.refresh()
+		case <-resize:
+		case <-sig:
+			return nil
+		}
+	}
+}
+
+// refresh fetches the tasks and computes the changes of their counters since
+// the previous refresh. On error, the previous tasks are kept on screen.
+func (v *taskListView) refresh() {
+	tsks, err := fetchTasks()
+	v.err = err
+	if err != nil {
+		return
+	}
+	sort.Sort(byCreation(tsks))
+
+	deltas := map[string]taskCounters{}
+	current := map[string]taskCounters{}
+	for _, t := range tsks {
+		c := taskCounters{state: t.TaskState, hit: t.HitCount, miss: t.MissCount, failed: t.FailedCount}
+		current[t.ID] = c
+		if p, ok := v.prev[t.ID]; ok {
+			deltas[t.ID] = taskCounters{
+				state:  p.state,
+				hit:    c.hit - p.hit,
+				miss:   c.miss - p.miss,
+				failed: c.failed - p.failed,
+			}
+		}
+	}
+	v.tasks = tsks
+	v.deltas = deltas
+	// the first refresh has no previous state to compare with
+	if v.prev == nil {
+		v.deltas = nil
+	}
+	v.prev = current
+	v.updated = time.Now()
+}
+
+// render draws the task list for the current terminal size. Tasks whose state
+// changed since the previous refresh are highlighted in yellow, tasks whose
+// failure count increased in red.
+func (v *taskListView) render() string {
+	termWidth, termHeight, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		termWidth, termHeight = 165, 50
+	}
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	printFields(w, false, 0,
+		"ID",
+		"NAME",
+		"STATE",
+		"HIT",
+		"MISS",
+		"FAIL",
+		"HIT RATE",
+		"LAST FAILURE",
+	)
+	colors := []string{ansiBold}
+	for _, t := range v.tasks {
+		d, ok := v.deltas[t.ID]
+		color := ""
+		switch {
+		case v.deltas != nil && !ok, ok && d.state != t.TaskState:
+			color = ansiYellow
+		case ok && d.failed > 0:
+			color = ansiRed
+		}
+		colors = append(colors, color)
+		printFields(w, false, 0,
+			t.ID,
+			t.Name,
+			t.TaskState,
+			withDelta(t.HitCount, d.hit, ok),
+			withDelta(t.MissCount, d.miss, ok),
+			withDelta(t.FailedCount, d.failed, ok),
+			hitRate(d, ok),
+			t.LastFailureMessage,
+		)
+	}
+	w.Flush()
+
+	var out bytes.Buffer
+	out.WriteString(ansiHome)
+	header := fmt.Sprintf("Every %v: snaptel task list    %s    (Ctrl-C to quit)", v.interval, v.updated.Format(time.RFC1123))
+	out.WriteString(truncLine(header, termWidth) + ansiClearLine + "\n")
+	if v.err != nil {
+		out.WriteString(ansiRed + truncLine("Error: "+apiErrorMessage(v.err), termWidth) + ansiReset)
+	} else if len(v.tasks) == 0 {
+		out.WriteString("No task found. Have you created a task?")
+	}
+	out.WriteString(ansiClearLine + "\n")
+
+	lines := strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")
+	if len(v.tasks) == 0 {
+		lines = nil
+	}
+	for i, l := range lines {
+		// keep the lines which fit on the screen below the header
+		if i+2 >= termHeight {
+			break
+		}
+		l = truncLine(l, termWidth)
+		if colors[i] != "" {
+			l = colors[i] + l + ansiReset
+		}
+		out.WriteString(l + ansiClearLine + "\n")
+	}
+	out.WriteString(ansiClearBelow)
+	return out.String()
+}
+
+// withDelta formats a counter followed by its change since the previous refresh.
+func withDelta(n, delta int64, ok bool) string {
+	if !ok {
+		return trunc(int(n))
+	}
+	return fmt.Sprintf("%s (%+d)", trunc(int(n)), delta)
+}
+
+// hitRate is the share of hits among the runs of the last interval.
+func hitRate(d taskCounters, ok bool) string {
+	runs := d.hit + d.miss + d.failed
+	if !ok || runs <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(d.hit)*100/float64(runs))
+}
+
+// truncLine cuts a line to the terminal width so it does not wrap.
+func truncLine(l string, width int) string {
+	r := []rune(l)
+	if width > 0 && len(r) > width {
+		return string(r[:width])
+	}
+	return l
+}
+
+// byCreation sorts tasks by creation time.
+type byCreation []*models.Task
+
+func (s byCreation) Len() int {
+	return len(s)
+}
+func (s byCreation) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s byCreation) Less(i, j int) bool {
+	if s[i].CreationTimestamp != s[j].CreationTimestamp {
+		return s[i].CreationTimestamp < s[j].CreationTimestamp
+	}
+	return s[i].ID < s[j].ID
+}
@@ -0,0 +1,621 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2017 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snaptel
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/intelsdi-x/snap-client-go/models"
+	"github.com/urfave/cli"
+)
+
+const (
+	ansiReverse = "\033[7m"
+	// refresh interval of the task and plugin panes
+	uiRefreshInterval = 2 * time.Second
+	// longest wait for a key before readKeys checks whether it is stopped
+	keyPollInterval = 100 * time.Millisecond
+)
+
+// Focusable panes of the dashboard; the bottom pane shows either the watched
+// task or the details of a metric.
+const (
+	paneTasks = iota
+	panePlugins
+	paneMetrics
+	paneCount
+)
+
+// uiData is the result of a background refresh of the tasks and plugins.
+type uiData struct {
+	tasks      []*models.Task
+	plugins    []*models.Plugin
+	metrics    []*models.Metric
+	hasMetrics bool
+	err        error
+}
+
+// uiWatchMsg carries the events of the watched task to the main loop.
+type uiWatchMsg struct {
+	gen   int
+	resp  *http.Response
+	event *models.StreamedTaskEvent
+	err   error
+	done  bool
+}
+
+// uiResult is the outcome of a task action.
+type uiResult struct {
+	msg string
+	err error
+}
+
+type dashboard struct {
+	ctx     *cli.Context
+	focus   int
+	sel     [paneCount]int
+	tasks   []*models.Task
+	plugins []*models.Plugin
+	metrics []*models.Metric
+
+	// bottom pane
+	detailTitle string
+	detailLines []string
+	watchID     string
+	watchGen    int
+	watchResp   *http.Response
+	watchRows   map[string][]interface{}
+
+	status  string
+	confirm string
+
+	data    chan uiData
+	watch   chan uiWatchMsg
+	results chan uiResult
+}
+
+func runUI(ctx *cli.Context) error {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return fmt.Errorf("snaptel ui requires an interactive terminal")
+	}
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("Error setting up the terminal: %v", err)
+	}
+	defer terminal.Restore(fd, state)
+
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	defer fmt.Print(ansiShowCursor + ansiAltScreenOff)
+
+	d := &dashboard{
+		ctx:         ctx,
+		detailTitle: "Watch",
+		detailLines: []string{"Select a task and press Enter to watch it."},
+		data:        make(chan uiData, 1),
+		watch:       make(chan uiWatchMsg, 64),
+		results:     make(chan uiResult, 1),
+	}
+	return d.run()
+}
+
+func (d *dashboard) run() error {
+	keys := make(chan string, 16)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		readKeys(keys, done)
+		close(stopped)
+	}()
+	// no read of the terminal is left behind, e.g. for the prompt of
+	// snaptel shell
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	ticker := time.NewTicker(uiRefreshInterval)
+	defer ticker.Stop()
+	defer d.stopWatch()
+
+	d.refresh(true)
+	for {
+		d.draw()
+		select {
+		case k := <-keys:
+			if !d.handleKey(k) {
+				return nil
+			}
+		case data := <-d.data:
+			d.update(data)
+		case msg := <-d.watch:
+			d.updateWatch(msg)
+		case res := <-d.results:
+			if res.err != nil {
+				d.status = "Error: " + d.errorMessage(res.err)
+			} else {
+				d.status = res.msg
+			}
+			d.refresh(false)
+		case <-ticker.C:
+			d.refresh(false)
+		case <-resize:
+		case <-sig:
+			return nil
+		}
+	}
+}
+
+// refresh fetches the tasks and running plugins, and the metric catalog if
+// asked to, without blocking the user interface.
+func (d *dashboard) refresh(withMetrics bool) {
+	go func() {
+		var data uiData
+		data.tasks, data.err = fetchTasks()
+		if data.err == nil {
+			data.plugins, data.err = fetchPlugins(true)
+		}
+		if data.err == nil && withMetrics {
+			data.metrics, data.err = queryMetrics(d.ctx)
+			data.hasMetrics = data.err == nil
+		}
+		d.data <- data
+	}()
+}
+
+func (d *dashboard) update(data uiData) {
+	if data.err != nil {
+		d.status = "Error: " + d.errorMessage(data.err)
+		return
+	}
+	sort.Sort(byCreation(data.tasks))
+	d.tasks = data.tasks
+	d.plugins = data.plugins
+	if data.hasMetrics {
+		d.metrics = data.metrics
+	}
+	d.clampSelection()
+}
+
+// errorMessage returns the message of an API error without the usage text.
+func (d *dashboard) errorMessage(err error) string {
+	if ue, ok := err.(UsageError); ok {
+		return ue.s
+	}
+	return apiErrorMessage(err)
+}
+
+func (d *dashboard) clampSelection() {
+	lens := [paneCount]int{len(d.tasks), len(d.plugins), len(d.metrics)}
+	for i, l := range lens {
+		if d.sel[i] >= l {
+			d.sel[i] = l - 1
+		}
+		if d.sel[i] < 0 {
+			d.sel[i] = 0
+		}
+	}
+}
+
+func (d *dashboard) selectedTask() *models.Task {
+	if len(d.tasks) == 0 {
+		return nil
+	}
+	return d.tasks[d.sel[paneTasks]]
+}
+
+// handleKey applies a key press and returns false when the dashboard has to exit.
+func (d *dashboard) handleKey(k string) bool {
+	if d.confirm != "" {
+		id := d.confirm
+		d.confirm = ""
+		if k == "y" || k == "Y" {
+			d.status = "Removing task " + id + "..."
+			d.taskAction(id, "remove")
+		} else {
+			d.status = "Cancelled"
+		}
+		return true
+	}
+
+	switch k {
+	case "q", "ctrl-c":
+		return false
+	case "tab":
+		d.focus = (d.focus + 1) % paneCount
+	case "backtab":
+		d.focus = (d.focus + paneCount - 1) % paneCount
+	case "up", "k":
+		d.sel[d.focus]--
+	case "down", "j":
+		d.sel[d.focus]++
+	case "home", "g":
+		d.sel[d.focus] = 0
+	case "end", "G":
+		d.sel[d.focus] = 1 << 30
+	case "r":
+		d.status = "Refreshing..."
+		d.refresh(true)
+	case "enter":
+		d.open()
+	case "s", "x", "e", "d":
+		t := d.selectedTask()
+		if d.focus != paneTasks || t == nil {
+			break
+		}
+		switch k {
+		case "s":
+			d.taskAction(t.ID, "start")
+		case "x":
+			d.taskAction(t.ID, "stop")
+		case "e":
+			d.taskAction(t.ID, "enable")
+		case "d":
+			d.confirm = t.ID
+			d.status = fmt.Sprintf("Remove task %s (%s)? [y/N]", t.Name, t.ID)
+		}
+	}
+	d.clampSelection()
+	return true
+}
+
+// open watches the selected task or shows the details of the selected metric.
+func (d *dashboard) open() {
+	switch d.focus {
+	case paneTasks:
+		if t := d.selectedTask(); t != nil {
+			d.startWatch(t.ID)
+		}
+	case paneMetrics:
+		if len(d.metrics) == 0 {
+			return
+		}
+		d.stopWatch()
+		m := d.metrics[d.sel[paneMetrics]]
+		d.detailTitle = "Metric " + getNamespace(m)
+		d.detailLines = metricDetails(m)
+	}
+}
+
+func (d *dashboard) taskAction(id, action string) {
+	go func() {
+		var err error
+		if action == "remove" {
+			err = removeTaskByID(id)
+		} else {
+			err = updateTaskState(id, action)
+		}
+		d.results <- uiResult{msg: fmt.Sprintf("Task %s: %s done", id, action), err: err}
+	}()
+}
+
+func (d *dashboard) startWatch(id string) {
+	d.stopWatch()
+	d.watchID = id
+	d.watchGen++
+	gen := d.watchGen
+	d.watchRows = map[string][]interface{}{}
+	d.detailTitle = "Watching task " + id
+	d.detailLines = []string{"Waiting for metrics..."}
+	go func() {
+		resp, err := openTaskWatch(id)
+		if err != nil {
+			d.watch <- uiWatchMsg{gen: gen, err: err, done: true}
+			return
+		}
+		d.watch <- uiWatchMsg{gen: gen, resp: resp}
+		err = readTaskWatch(resp.Body, func(e *models.StreamedTaskEvent) error {
+			d.watch <- uiWatchMsg{gen: gen, event: e}
+			return nil
+		})
+		d.watch <- uiWatchMsg{gen: gen, err: err, done: true}
+	}()
+}
+
+func (d *dashboard) stopWatch() {
+	if d.watchResp != nil {
+		d.watchResp.Body.Close()
+		d.watchResp = nil
+	}
+	d.watchID = ""
+}
+
+func (d *dashboard) updateWatch(msg uiWatchMsg) {
+	// the stream of a task which is not watched anymore
+	if msg.gen != d.watchGen || d.watchID == "" {
+		if msg.resp != nil {
+			msg.resp.Body.Close()
+		}
+		return
+	}
+	switch {
+	case msg.resp != nil:
+		d.watchResp = msg.resp
+	case msg.event != nil:
+		for _, e := range msg.event.Event {
+			key := e.Namespace + " " + strings.Join(sortTags(e.Tags), ",")
+			d.watchRows[key] = []interface{}{e.Namespace, e.Data, e.Timestamp, strings.Join(sortTags(e.Tags), ", ")}
+		}
+		var keys []string
+		for k := range d.watchRows {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		rows := make([][]interface{}, 0, len(keys))
+		for _, k := range keys {
+			rows = append(rows, d.watchRows[k])
+		}
+		d.detailLines = tableLines([]interface{}{"NAMESPACE", "DATA", "TIMESTAMP", "TAGS"}, rows)
+	case msg.done:
+		d.watchResp = nil
+		d.watchID = ""
+		if msg.err != nil {
+			d.detailLines = append(d.detailLines, "Error: "+msg.err.Error())
+		} else {
+			d.detailLines = append(d.detailLines, "Task watch stream ended.")
+		}
+	}
+}
+
+func metricDetails(m *models.Metric) []string {
+	lines := []string{
+		fmt.Sprintf("Version: %d    Unit: %s    Last advertised: %s", m.Version, m.Unit, time.Unix(m.LastAdvertisedTimestamp, 0).Format(time.RFC1123)),
+		"Description: " + m.Description,
+		"",
+		"Rules:",
+	}
+	var rows [][]interface{}
+	for _, rule := range m.Policy {
+		rows = append(rows, []interface{}{rule.Name, rule.Type, rule.Default, rule.Required, rule.Minimum, rule.Maximum})
+	}
+	return append(lines, tableLines([]interface{}{"NAME", "TYPE", "DEFAULT", "REQUIRED", "MINIMUM", "MAXIMUM"}, rows)...)
+}
+
+// tableLines aligns a header and rows into lines of text.
+func tableLines(header []interface{}, rows [][]interface{}) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	printFields(w, false, 0, header...)
+	for _, r := range rows {
+		printFields(w, false, 0, r...)
+	}
+	w.Flush()
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func (d *dashboard) draw() {
+	width, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 120, 40
+	}
+	avail := height - 2
+	hTasks := avail * 35 / 100
+	hMiddle := avail * 30 / 100
+	hBottom := avail - hTasks - hMiddle
+
+	var rows [][]interface{}
+	for _, t := range d.tasks {
+		rows = append(rows, []interface{}{t.ID, t.Name, t.TaskState, trunc(int(t.HitCount)), trunc(int(t.MissCount)), trunc(int(t.FailedCount)), t.LastFailureMessage})
+	}
+	lines := d.pane(paneTasks, "Tasks", tableLines([]interface{}{"ID", "NAME", "STATE", "HIT", "MISS", "FAIL", "LAST FAILURE"}, rows), width, hTasks)
+
+	rows = nil
+	for _, p := range d.plugins {
+		rows = append(rows, []interface{}{p.Name, p.Type, p.HitCount, time.Unix(p.LastHitTimestamp, 0).Format(time.RFC1123)})
+	}
+	left := (width - 3) / 2
+	plgs := d.pane(panePlugins, "Running plugins", tableLines([]interface{}{"NAME", "TYPE", "HIT COUNT", "LAST HIT"}, rows), left, hMiddle)
+
+	rows = nil
+	for _, m := range d.metrics {
+		rows = append(rows, []interface{}{getNamespace(m), m.Version, m.Unit})
+	}
+	mets := d.pane(paneMetrics, "Metric catalog", tableLines([]interface{}{"NAMESPACE", "VERSION", "UNIT"}, rows), width-3-left, hMiddle)
+	for i := range plgs {
+		lines = append(lines, plgs[i]+" | "+mets[i])
+	}
+
+	lines = append(lines, d.detailPane(width, hBottom)...)
+
+	var out bytes.Buffer
+	out.WriteString(ansiHome)
+	out.WriteString(ansiReverse + fitLine(fmt.Sprintf(" snaptel ui - %s", FlURL.Value), width) + ansiReset + ansiClearLine + "\r\n")
+	for _, l := range lines {
+		out.WriteString(l + ansiClearLine + "\r\n")
+	}
+	out.WriteString(fitLine(d.statusLine(), width) + ansiClearLine)
+	out.WriteString(ansiClearBelow)
+	os.Stdout.Write(out.Bytes())
+}
+
+// pane renders a list pane as its title, its header and the rows around the
+// selected one, each line padded to width.
+func (d *dashboard) pane(id int, title string, table []string, width, height int) []string {
+	titleStyle := ansiBold
+	if d.focus == id {
+		titleStyle = ansiReverse
+	}
+	lines := []string{titleStyle + fitLine(" "+title, width) + ansiReset}
+	if height < 2 {
+		return lines[:height]
+	}
+	header, rows := table[0], table[1:]
+	lines = append(lines, ansiBold+fitLine(header, width)+ansiReset)
+
+	visible := height - 2
+	sel := d.sel[id]
+	offset := 0
+	if sel >= visible {
+		offset = sel - visible + 1
+	}
+	for i := offset; i < offset+visible; i++ {
+		if i >= len(rows) {
+			lines = append(lines, fitLine("", width))
+			continue
+		}
+		l := fitLine(rows[i], width)
+		if i == sel && d.focus == id {
+			l = ansiReverse + l + ansiReset
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func (d *dashboard) detailPane(width, height int) []string {
+	if height < 1 {
+		return nil
+	}
+	lines := []string{ansiBold + fitLine(" "+d.detailTitle, width) + ansiReset}
+	for i := 0; i < height-1; i++ {
+		l := ""
+		if i < len(d.detailLines) {
+			l = d.detailLines[i]
+		}
+		lines = append(lines, fitLine(l, width))
+	}
+	return lines
+}
+
+func (d *dashboard) statusLine() string {
+	if d.status != "" && d.confirm != "" {
+		return d.status
+	}
+	help := "[Tab] pane  [Up/Down] select  [r] refresh  [q] quit"
+	switch d.focus {
+	case paneTasks:
+		help = "[Enter] watch  [s] start  [x] stop  [e] enable  [d] remove  " + help
+	case paneMetrics:
+		help = "[Enter] details  " + help
+	}
+	if d.status != "" {
+		return d.status + "  |  " + help
+	}
+	return help
+}
+
+// fitLine truncates or pads a line to exactly width characters.
+func fitLine(l string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	r := []rune(l)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return l + strings.Repeat(" ", width-len(r))
+}
+
+// readKeys reads the keyboard from the terminal in raw mode and sends the
+// name of every key pressed, until done is closed.
+func readKeys(keys chan<- string, done <-chan struct{}) {
+	send := func(k string) bool {
+		select {
+		case keys <- k:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	fd := int(os.Stdin.Fd())
+	if err := setKeyTimeout(fd); err != nil {
+		send("ctrl-c")
+		return
+	}
+	buf := make([]byte, 32)
+	for {
+		n, err := readKey(fd, buf)
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if err != nil {
+			send("ctrl-c")
+			return
+		}
+		b := buf[:n]
+		for len(b) > 0 {
+			k, size := parseKey(b)
+			b = b[size:]
+			if k != "" && !send(k) {
+				return
+			}
+		}
+	}
+}
+
+// parseKey returns the name of the key at the start of b and its length.
+func parseKey(b []byte) (string, int) {
+	if b[0] == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O') {
+		switch b[2] {
+		case 'A':
+			return "up", 3
+		case 'B':
+			return "down", 3
+		case 'C':
+			return "right", 3
+		case 'D':
+			return "left", 3
+		case 'H':
+			return "home", 3
+		case 'F':
+			return "end", 3
+		case 'Z':
+			return "backtab", 3
+		}
+		// skip other sequences, e.g. ESC [ 5 ~
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return "", i + 1
+			}
+		}
+		return "", len(b)
+	}
+	switch b[0] {
+	case 0x03:
+		return "ctrl-c", 1
+	case '\t':
+		return "tab", 1
+	case '\r', '\n':
+		return "enter", 1
+	case 0x1b:
+		return "esc", 1
+	}
+	return string(b[:1]), 1
+}
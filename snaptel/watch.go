@@ -22,7 +22,6 @@ package snaptel
 import (
 	"bufio"
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -33,11 +32,16 @@ import (
 	"strings"
 	"syscall"
 	"text/tabwriter"
+	"time"
 
+	"github.com/intelsdi-x/snap-client-go/client/tasks"
 	"github.com/intelsdi-x/snap-client-go/models"
 	"github.com/urfave/cli"
 )
 
+// time to wait before subscribing again to a task watch stream which ended
+var watchRetryInterval = 5 * time.Second
+
 type watchErrorResponse struct {
 	Message string
 }
@@ -49,57 +53,60 @@ func watchTask(ctx *cli.Context) error {
 
 	verbose := ctx.Bool("verbose")
 	id := ctx.Args().First()
-	url := fmt.Sprintf("%s/%s/tasks/%s/watch", FlURL.Value, FlAPIVer.Value, id)
 
-	// Currently, there is no way to implement a proper idel timeout for streaming.
-	// Therefore no timeout for this request.
-	req, err := http.NewRequest("GET", url, nil)
-	req.SetBasicAuth("snap", password)
-	if err != nil {
-		return err
+	var rules []*alertRule
+	for _, a := range ctx.StringSlice("alert") {
+		r, err := parseAlertRule(a)
+		if err != nil {
+			return newUsageError(err.Error(), ctx)
+		}
+		rules = append(rules, r)
 	}
-
-	tr := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if ctx.IsSet("exec") && len(rules) == 0 {
+		return newUsageError("The --exec flag requires at least one --alert rule", ctx)
 	}
-	wtClient := http.Client{Transport: &tr}
-	resp, err := wtClient.Do(req)
+
+	resp, err := openTaskWatch(id)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	var lines int
-	// Catch interrupt signal so we can return to command line without formatting issues
+	// Catch interrupt signal so we can return to command line without
+	// formatting issues: the stream is closed, which ends the watch, rather
+	// than snaptel, e.g. from the shell
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	signal.Notify(c, syscall.SIGTERM)
+	defer signal.Stop(c)
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		<-c
-		fmt.Printf("%sStopping task watch\n", strings.Repeat("\n", lines))
-		resp.Body.Close()
-		os.Exit(0)
-	}()
-
-	// Decode and display error message in case of error response
-
-	if resp.StatusCode == 500 {
-		errRespBody, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("An error occured while reading task watch error response: %s", err)
+		select {
+		case <-c:
+			close(stopped)
+			resp.Body.Close()
+		case <-done:
 		}
-		errResp := watchErrorResponse{}
-		err = json.Unmarshal(errRespBody, &errResp)
-		if err != nil {
-			return fmt.Errorf("An error occured while unmarshalling task watch error response JSON data: %s", err)
+	}()
+	// finish ignores the error of the stream closed on interrupt
+	finish := func(err error) error {
+		select {
+		case <-stopped:
+			fmt.Printf("%sStopping task watch\n", strings.Repeat("\n", lines))
+			return nil
+		default:
+			return err
 		}
-		return fmt.Errorf(errResp.Message)
 	}
 
-	var tskEvent models.StreamedTaskEvent
-	reader := bufio.NewReader(resp.Body)
-
-	fmt.Printf("Watching Task (%s):\n", id)
+	if len(rules) > 0 {
+		fmt.Printf("Watching Task (%s) for alerts:\n", id)
+		am := newAlertManager(id, rules, ctx.String("exec"))
+		return finish(readTaskWatch(resp.Body, am.handle))
+	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 	fields := []interface{}{"NAMESPACE", "DATA", "TIMESTAMP"}
@@ -107,26 +114,18 @@ func watchTask(ctx *cli.Context) error {
 		fields = append(fields, "TAGS")
 	}
 
-	for {
-		bs, err := reader.ReadBytes('\n')
-		if err != nil && err != io.EOF {
-			return err
-		}
-
-		if len(bs) < 2 {
-			continue
-		}
-
-		bsData := bytes.TrimPrefix(bytes.TrimSpace(bs), []byte("data: "))
-		if len(bsData) == 0 {
-			continue
-		}
+	if isStreamingTask(id) {
+		fmt.Printf("Watching streaming Task (%s), metrics are printed as they arrive:\n", id)
+		printFields(w, false, 0, fields...)
+		return finish(readTaskWatch(resp.Body, func(tskEvent *models.StreamedTaskEvent) error {
+			printStreamedEvents(w, tskEvent, verbose)
+			return nil
+		}))
+	}
 
-		err = json.Unmarshal(bsData, &tskEvent)
-		if err != nil {
-			return fmt.Errorf("Error unmarshal task stream: %v", err)
-		}
+	fmt.Printf("Watching Task (%s):\n", id)
 
+	return finish(readTaskWatch(resp.Body, func(tskEvent *models.StreamedTaskEvent) error {
 		var extra int
 
 		// Print header fields if data received
@@ -180,10 +179,123 @@ func watchTask(ctx *cli.Context) error {
 		lines = len(tskEvent.Event) + extra
 		fmt.Fprintf(w, "\033[%dA\n", lines+1)
 		w.Flush()
+		return nil
+	}))
+}
+
+// isStreamingTask tells whether the task has a 'streaming' schedule. Its
+// metrics arrive one by one, so they are listed rather than redrawn in place.
+func isStreamingTask(id string) bool {
+	params := tasks.NewGetTaskParamsWithTimeout(FlTimeout.Value)
+	params.SetID(id)
+	resp, err := client.Tasks.GetTask(params, authInfoWriter)
+	if err != nil || resp.Payload == nil || resp.Payload.Schedule == nil {
+		return false
+	}
+	return scheduleType(resp.Payload.Schedule) == "streaming"
+}
+
+// printStreamedEvents appends the metrics of a streaming task to the output.
+func printStreamedEvents(w *tabwriter.Writer, tskEvent *models.StreamedTaskEvent, verbose bool) {
+	for _, e := range tskEvent.Event {
+		eventFields := []interface{}{
+			e.Namespace,
+			e.Data,
+			e.Timestamp,
+		}
+		if verbose {
+			eventFields = append(eventFields, strings.Join(sortTags(e.Tags), ", "))
+		}
+		printFields(w, false, 0, eventFields...)
+	}
+	w.Flush()
+}
+
+// openTaskWatch opens the event stream of the given task. The caller is
+// responsible for closing the response body.
+func openTaskWatch(id string) (*http.Response, error) {
+	url := fmt.Sprintf("%s/%s/tasks/%s/watch", FlURL.Value, FlAPIVer.Value, id)
+
+	// Currently, there is no way to implement a proper idel timeout for streaming.
+	// Therefore no timeout for this request.
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticateRequest(req); err != nil {
+		return nil, err
+	}
+	req = withoutRetries(req)
+
+	// the transport of the API client, with its TLS settings and logging
+	wtClient := http.Client{}
+	if httpClient != nil {
+		wtClient.Transport = httpClient.Transport
+	}
+	resp, err := wtClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode and display error message in case of error response
+	if resp.StatusCode == 500 {
+		defer resp.Body.Close()
+		errRespBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("An error occured while reading task watch error response: %s", err)
+		}
+		errResp := watchErrorResponse{}
+		err = json.Unmarshal(errRespBody, &errResp)
+		if err != nil {
+			return nil, fmt.Errorf("An error occured while unmarshalling task watch error response JSON data: %s", err)
+		}
+		return nil, fmt.Errorf(errResp.Message)
+	}
+	return resp, nil
+}
+
+// readTaskWatch decodes the events of a task watch stream and hands each of
+// them to fn until the stream ends or fn returns an error.
+func readTaskWatch(r io.Reader, fn func(*models.StreamedTaskEvent) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		bs, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		bsData := bytes.TrimPrefix(bytes.TrimSpace(bs), []byte("data: "))
+		if len(bs) >= 2 && len(bsData) > 0 {
+			var tskEvent models.StreamedTaskEvent
+			if e := json.Unmarshal(bsData, &tskEvent); e != nil {
+				return fmt.Errorf("Error unmarshal task stream: %v", e)
+			}
+			if e := fn(&tskEvent); e != nil {
+				return e
+			}
+		}
 
 		if err == io.EOF {
-			break
+			return nil
+		}
+	}
+}
+
+// subscribeTaskWatch keeps consuming the event stream of a task, subscribing
+// again whenever the stream ends or fails.
+func subscribeTaskWatch(id string, fn func(string, *models.StreamedTaskEvent)) {
+	for {
+		resp, err := openTaskWatch(id)
+		if err == nil {
+			err = readTaskWatch(resp.Body, func(e *models.StreamedTaskEvent) error {
+				fn(id, e)
+				return nil
+			})
+			resp.Body.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching task %s: %v\n", id, err)
 		}
+		time.Sleep(watchRetryInterval)
 	}
-	return nil
 }